@@ -0,0 +1,171 @@
+package async
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// consumer 一个消费函数及其写出队列，每个 consumer 由自己的 worker 写出，慢的 consumer 不影响采集与其他 consumer
+type consumer[T any] struct {
+	task    string          // 所属任务名称
+	name    string          // consumer 名称
+	fn      func([]T) error // 消费函数，同一批数据会交给所有 consumer，不能修改
+	queue   chan []T        // 等待写出的批次
+	workers sync.WaitGroup
+
+	flushed atomic.Uint64 // 成功处理的条数
+	failed  atomic.Uint64 // 处理失败的条数
+	dropped atomic.Uint64 // 队列已满时丢弃的条数
+	errors  atomic.Uint64 // 返回错误或 panic 的次数
+
+	mu          sync.Mutex    // 保护以下写出统计
+	batches     uint64        // 写出的批次数
+	lastFlush   time.Duration // 最近一批的写出耗时
+	maxFlush    time.Duration // 最大写出耗时
+	totalFlush  time.Duration // 累计写出耗时
+	lastSuccess time.Time     // 最近一次写出成功的时间
+}
+
+// ConsumerStats consumer 计数
+type ConsumerStats struct {
+	Name           string    `json:"name"`
+	Queued         int       `json:"queued"`           // 等待写出的批次数
+	Flushed        uint64    `json:"flushed"`          // 成功处理的条数
+	Failed         uint64    `json:"failed"`           // 处理失败的条数
+	Dropped        uint64    `json:"dropped"`          // 队列已满时丢弃的条数
+	Errors         uint64    `json:"errors"`           // 返回错误或 panic 的次数
+	Batches        uint64    `json:"batches"`          // 写出的批次数
+	LastFlushMs    float64   `json:"last_flush_ms"`    // 最近一批的写出耗时（毫秒）
+	MaxFlushMs     float64   `json:"max_flush_ms"`     // 最大写出耗时（毫秒）
+	AvgFlushMs     float64   `json:"avg_flush_ms"`     // 平均写出耗时（毫秒）
+	LastSuccess    time.Time `json:"last_success"`     // 最近一次写出成功的时间
+	SinceLastFlush float64   `json:"since_last_flush"` // 距最近一次写出成功的秒数，从未成功为 -1
+}
+
+func newConsumer[T any](task, name string, fn func([]T) error, queueLen int) *consumer[T] {
+	return &consumer[T]{
+		task:  task,
+		name:  name,
+		fn:    fn,
+		queue: make(chan []T, queueLen),
+	}
+}
+
+// start 启动 n 个 worker
+func (c *consumer[T]) start(n int) {
+	for i := 0; i < n; i++ {
+		c.workers.Add(1)
+		go func() {
+			defer c.workers.Done()
+			for data := range c.queue {
+				c.call(data)
+			}
+		}()
+	}
+}
+
+// offer 放入写出队列，队列已满时丢弃，不阻塞采集
+func (c *consumer[T]) offer(data []T) {
+	select {
+	case c.queue <- data:
+	default:
+		c.dropped.Add(uint64(len(data)))
+		fmt.Println("consumer ", c.name, " of ", c.task, " is full, drop ", len(data), " items")
+	}
+}
+
+// offerWait 放入写出队列，队列已满时等待，返回是否已放入；ctx 到期后返回 false，由调用方决定是否丢弃
+func (c *consumer[T]) offerWait(ctx context.Context, data []T) bool {
+	select {
+	case c.queue <- data:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// stop 关闭队列并等待 worker 写完，ctx 到期后返回 ctx 的错误
+func (c *consumer[T]) stop(ctx context.Context) error {
+	close(c.queue)
+	done := make(chan struct{})
+	go func() {
+		c.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// call 调用消费函数，返回的错误与 panic 都计入 errors 并打印，不影响后续批次
+func (c *consumer[T]) call(data []T) (err error) {
+	// 不要判断len(data)
+	start := time.Now()
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("consumer panic: %v", rec)
+		}
+		c.record(time.Since(start), err == nil)
+		if err != nil {
+			c.errors.Add(1)
+			c.failed.Add(uint64(len(data)))
+			fmt.Println("consume ", len(data), " items of ", c.task, "/", c.name, " err:", err)
+			return
+		}
+		c.flushed.Add(uint64(len(data)))
+	}()
+
+	return c.fn(data)
+}
+
+// record 记录一次写出的耗时
+func (c *consumer[T]) record(elapsed time.Duration, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.batches++
+	c.lastFlush = elapsed
+	if elapsed > c.maxFlush {
+		c.maxFlush = elapsed
+	}
+	c.totalFlush += elapsed
+	if ok {
+		c.lastSuccess = time.Now()
+	}
+}
+
+// stats 当前计数
+func (c *consumer[T]) stats() ConsumerStats {
+	stats := ConsumerStats{
+		Name:           c.name,
+		Queued:         len(c.queue),
+		Flushed:        c.flushed.Load(),
+		Failed:         c.failed.Load(),
+		Dropped:        c.dropped.Load(),
+		Errors:         c.errors.Load(),
+		SinceLastFlush: -1,
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats.Batches = c.batches
+	stats.LastFlushMs = milliseconds(c.lastFlush)
+	stats.MaxFlushMs = milliseconds(c.maxFlush)
+	if c.batches > 0 {
+		stats.AvgFlushMs = milliseconds(c.totalFlush) / float64(c.batches)
+	}
+	if !c.lastSuccess.IsZero() {
+		stats.LastSuccess = c.lastSuccess
+		stats.SinceLastFlush = time.Since(c.lastSuccess).Seconds()
+	}
+	return stats
+}
+
+// milliseconds 转为毫秒
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -1,31 +1,126 @@
 package async
 
 import (
+	"context"
 	"fmt"
+	"moniter/conf"
+	"sort"
 	"sync"
-	"time"
 )
 
-var tasks = make(map[string]*Task)
+// task 不同数据类型的任务共用的接口
+type task interface {
+	Name() string
+	Stats() Stats
+	shutDown(ctx context.Context) error
+}
 
-// 基础支持 qps 1024
-const channelLen int = 1024
+// tasks 全部任务，名称 -> 任务
+var (
+	tasksMu sync.Mutex
+	tasks   = make(map[string]task)
+)
 
-// ShutDown 终止
-func ShutDown() {
-	var wg sync.WaitGroup
+// defaultTaskConfig 内置默认配置，基础支持 qps 1024
+var defaultTaskConfig = conf.TaskConfig{
+	BufferSize:    1024 * 5,
+	MaxBatchLen:   1024,
+	FlushInterval: 5,
+	Overflow:      OverflowBlock,
+	BlockTimeout:  1000,
+	SpillDir:      "./spill",
+	FlushWorkers:  1,
+	FlushQueue:    8,
+}
+
+// GetTask 按名称获取任务，不存在时按 config.json 中的 tasks 配置创建；
+// 同一名称只能对应一种数据类型，否则 panic
+func GetTask[T any](name string) *Task[T] {
+	tasksMu.Lock()
+	defer tasksMu.Unlock()
+	if t, ok := tasks[name]; ok {
+		typed, ok := t.(*Task[T])
+		if !ok {
+			panic(fmt.Sprintf("task %s already created as %T", name, t))
+		}
+		return typed
+	}
+	t := newTask[T](name, taskConfig(name))
+	tasks[name] = t
+	return t
+}
+
+// taskConfig 依次合并内置默认值、tasks.default 与 tasks.<name>
+func taskConfig(name string) conf.TaskConfig {
+	c := defaultTaskConfig
+	if conf.Sc != nil {
+		c = c.Merge(conf.Sc.Tasks["default"]).Merge(conf.Sc.Tasks[name])
+	}
+	return c
+}
+
+// AllStats 全部任务的计数，按名称排序
+func AllStats() []Stats {
+	tasksMu.Lock()
+	stats := make([]Stats, 0, len(tasks))
 	for _, t := range tasks {
+		stats = append(stats, t.Stats())
+	}
+	tasksMu.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// ShutDown 终止所有任务：停止接收新数据并消费完 channel 中剩余的数据，
+// ctx 到期后放弃未消费的数据并返回 ctx 的错误
+func ShutDown(ctx context.Context) error {
+	tasksMu.Lock()
+	all := make([]task, 0, len(tasks))
+	for _, t := range tasks {
+		all = append(all, t)
+	}
+	tasksMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range all {
 		wg.Add(1)
-		go func(t *Task) {
-			time.Sleep(time.Second)
-			cc := make(chan struct{}, 1)
-			fmt.Println("to close ", t.name)
-
-			t.close <- cc
-			<-cc
-			fmt.Println("closed ", t.name)
-			wg.Done()
+		go func(t task) {
+			defer wg.Done()
+			fmt.Println("to close ", t.Name())
+			if err := t.shutDown(ctx); err != nil {
+				fmt.Println("close ", t.Name(), " err:", err)
+				return
+			}
+			fmt.Println("closed ", t.Name())
 		}(t)
 	}
-	wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WaitGroup 等待 wg 归零，ctx 到期后返回 ctx 的错误，各模块的 Wait 共用
+func WaitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
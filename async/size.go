@@ -0,0 +1,34 @@
+package async
+
+import "reflect"
+
+// newSizer 估算一条数据占用的字节数：类型本身的大小加上字符串（或结构体中字符串字段）的长度
+func newSizer[T any]() func(T) int {
+	var zero T
+	typ := reflect.TypeOf(zero)
+	if typ == nil {
+		// T 为接口类型，无法预先知道大小
+		return func(T) int { return 0 }
+	}
+	base := int(typ.Size())
+	switch typ.Kind() {
+	case reflect.String:
+		return func(v T) int { return base + reflect.ValueOf(v).Len() }
+	case reflect.Struct:
+		var stringFields []int
+		for i := 0; i < typ.NumField(); i++ {
+			if typ.Field(i).Type.Kind() == reflect.String {
+				stringFields = append(stringFields, i)
+			}
+		}
+		return func(v T) int {
+			n := base
+			rv := reflect.ValueOf(v)
+			for _, i := range stringFields {
+				n += rv.Field(i).Len()
+			}
+			return n
+		}
+	}
+	return func(T) int { return base }
+}
@@ -0,0 +1,89 @@
+package async
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// spill 溢出到磁盘的数据，每行一个 JSON
+type spill[T any] struct {
+	path string
+	mu   sync.Mutex // 保护 path 文件的追加与改名
+}
+
+// write 追加一条数据
+func (s *spill[T]) write(v T) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replayPath 正在重放的文件
+func (s *spill[T]) replayPath() string {
+	return s.path + ".replay"
+}
+
+// read 读出已溢出的数据交给 handle，handle 返回 false 时停止，返回无法解析的行数；
+// 先改名再读取，读取期间新溢出的数据写入新文件，上次未重放完的 .replay 文件优先读取。
+// 读完不删除文件，数据都被接收后由调用方调用 remove
+func (s *spill[T]) read(handle func(v T) bool) (int, error) {
+	replay := s.replayPath()
+	s.mu.Lock()
+	if _, err := os.Stat(replay); os.IsNotExist(err) {
+		if err := os.Rename(s.path, replay); err != nil {
+			s.mu.Unlock()
+			if os.IsNotExist(err) {
+				return 0, nil
+			}
+			return 0, err
+		}
+	}
+	s.mu.Unlock()
+
+	f, err := os.Open(replay)
+	if err != nil {
+		return 0, err
+	}
+	bad := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var v T
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			bad++
+			continue
+		}
+		if !handle(v) {
+			break
+		}
+	}
+	f.Close()
+	return bad, scanner.Err()
+}
+
+// remove 删除已重放完的文件
+func (s *spill[T]) remove() error {
+	err := os.Remove(s.replayPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
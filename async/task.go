@@ -1,73 +1,216 @@
 package async
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"moniter/conf"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// channel 已满时的处理策略
+const (
+	OverflowBlock      = "block"       // 阻塞等待，超过 block_timeout 后丢弃
+	OverflowDropNewest = "drop_newest" // 丢弃新数据
+	OverflowDropOldest = "drop_oldest" // 丢弃 channel 中最旧的数据，放入新数据
+	OverflowSpill      = "spill"       // 溢出到磁盘，定时写出时一并消费
+)
+
+var (
+	// ErrClosed 任务已关闭
+	ErrClosed = errors.New("task closed")
+	// ErrDropped channel 已满，数据被丢弃
+	ErrDropped = errors.New("task queue full")
+)
+
 // Task is a struct that represents a task
-type Task struct {
-	name        string              // task的名称
-	collectTime time.Duration       // 收集时间
-	channelLen  int64               // 临时chan长度
-	collect     chan interface{}    // 全部收集的信息
-	data        []interface{}       // 部分收集的信息
-	maxDataLen  int                 // 临时信息最大长度，超过后会触发consumer
-	consumer    func([]interface{}) // 消费函数 接收一个已经关闭的chan
+type Task[T any] struct {
+	name         string        // task的名称
+	collectTime  time.Duration // 收集时间
+	channelLen   int64         // 临时chan长度
+	collect      chan T        // 全部收集的信息
+	data         []T           // 部分收集的信息
+	dataBytes    int           // data 估算的字节数
+	maxDataLen   int           // 临时信息最大长度，超过后会触发consumer
+	maxDataBytes int           // 临时信息最大字节数，超过后会触发consumer，0 为不限制
+	sizeOf       func(T) int   // 估算一条信息的字节数
+
+	consumers []*consumer[T] // 消费函数，每批数据交给全部 consumer
+	workers   int            // 每个 consumer 的 worker 数
+	queueLen  int            // 每个 consumer 等待写出的最大批次数
+	wait      atomic.Bool    // consumer 队列已满时是否等待而不是丢弃
+
+	overflow     string        // channel 已满时的处理策略
+	blockTimeout time.Duration // overflow 为 block 时的最长等待时间
+	spill        *spill[T]     // overflow 为 spill 时的磁盘文件
 
-	close chan chan struct{} // 关闭任务
+	mu       sync.RWMutex       // 保护 closed 与 inflight 的增加，只在检查时短暂持有，阻塞时不持有
+	closed   bool               // 关闭后 Pub 不再写 channel
+	inflight sync.WaitGroup     // 正在执行的 Pub、PubWait，全部返回后才能关闭 channel
+	stopped  context.Context    // 关闭时取消，唤醒阻塞中的 Pub、PubWait 与溢出数据的重放
+	stop     context.CancelFunc // 取消 stopped
+
+	published atomic.Uint64 // 接收的条数（含溢出到磁盘的）
+	dropped   atomic.Uint64 // 丢弃的条数
+	spilled   atomic.Uint64 // 溢出到磁盘的条数
+
+	batchMu    sync.Mutex // 保护以下批次统计
+	batches    uint64     // 产生的批次数
+	batchItems uint64     // 产生的批次累计条数
+	lastBatch  int        // 最近一批的条数
+	maxBatch   int        // 最大一批的条数
+
+	close chan closeRequest // 关闭任务
 }
 
-func CPUTask() *Task {
-	name := "cpu"
+// Stats 任务计数
+type Stats struct {
+	Name      string `json:"name"`
+	Queued    int    `json:"queued"`    // channel 中等待处理的条数
+	Published uint64 `json:"published"` // 接收的条数（含溢出到磁盘的）
+	Dropped   uint64 `json:"dropped"`   // 丢弃的条数，含各 consumer 队列已满时丢弃的条数
+	Spilled   uint64 `json:"spilled"`   // 溢出到磁盘的条数
+	Flushed   uint64 `json:"flushed"`   // 各 consumer 成功处理的条数之和
+	Failed    uint64 `json:"failed"`    // 各 consumer 处理失败的条数之和
+	Errors    uint64 `json:"errors"`    // 各 consumer 返回错误或 panic 的次数之和
 
-	t, ok := tasks[name]
-	if ok {
-		return t
-	}
-	tasks[name] = newTask(name, int64(channelLen*5), time.Second*5, channelLen)
-	return tasks[name]
+	Batches        uint64    `json:"batches"`          // 产生的批次数
+	LastBatchSize  int       `json:"last_batch_size"`  // 最近一批的条数
+	MaxBatchSize   int       `json:"max_batch_size"`   // 最大一批的条数
+	AvgBatchSize   float64   `json:"avg_batch_size"`   // 平均每批条数
+	LastFlushMs    float64   `json:"last_flush_ms"`    // 各 consumer 最近一批写出耗时的最大值（毫秒）
+	MaxFlushMs     float64   `json:"max_flush_ms"`     // 最大写出耗时（毫秒）
+	AvgFlushMs     float64   `json:"avg_flush_ms"`     // 平均写出耗时（毫秒）
+	LastSuccess    time.Time `json:"last_success"`     // 最慢的 consumer 最近一次写出成功的时间
+	SinceLastFlush float64   `json:"since_last_flush"` // 最慢的 consumer 距最近一次写出成功的秒数，有 consumer 从未成功为 -1
+
+	Consumers []ConsumerStats `json:"consumers"` // 各 consumer 的计数
 }
-func MemoryTask() *Task {
-	name := "memory"
 
-	t, ok := tasks[name]
-	if ok {
-		return t
-	}
-	tasks[name] = newTask(name, int64(channelLen*5), time.Second*5, channelLen)
-	return tasks[name]
+// closeRequest 关闭请求，ctx 到期后放弃剩余数据
+type closeRequest struct {
+	ctx  context.Context
+	done chan struct{}
 }
-func IOTask() *Task {
-	name := "io"
 
-	t, ok := tasks[name]
-	if ok {
-		return t
+func newTask[T any](name string, c conf.TaskConfig) *Task[T] {
+	t := &Task[T]{
+		name:         name,
+		collectTime:  time.Duration(c.FlushInterval) * time.Second,
+		channelLen:   int64(c.BufferSize),
+		collect:      make(chan T, c.BufferSize),
+		data:         make([]T, 0),
+		maxDataLen:   c.MaxBatchLen,
+		maxDataBytes: c.MaxBatchBytes,
+		sizeOf:       newSizer[T](),
+		workers:      c.FlushWorkers,
+		queueLen:     c.FlushQueue,
+		overflow:     c.Overflow,
+		blockTimeout: time.Duration(c.BlockTimeout) * time.Millisecond,
+		close:        make(chan closeRequest, 1),
 	}
-	tasks[name] = newTask(name, int64(channelLen*5), time.Second*5, channelLen)
-	return tasks[name]
+	t.stopped, t.stop = context.WithCancel(context.Background())
+	switch c.Overflow {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+	case OverflowSpill:
+		t.spill = &spill[T]{path: filepath.Join(c.SpillDir, name+".spill")}
+	default:
+		panic(fmt.Sprintf("task %s: unknown overflow policy %q", name, c.Overflow))
+	}
+	return t
+}
+
+// Name 任务名称
+func (t *Task[T]) Name() string {
+	return t.name
+}
+
+// SetConsumer 设置唯一的消费函数，替换已添加的 consumer
+func (t *Task[T]) SetConsumer(fn func([]T) error) {
+	t.consumers = nil
+	t.AddConsumer("default", fn)
+}
+
+// AddConsumer 添加一个消费函数，每批数据交给全部 consumer，各自排队、各自计数，需在 Async 之前调用
+func (t *Task[T]) AddConsumer(name string, fn func([]T) error) {
+	t.consumers = append(t.consumers, newConsumer(t.name, name, fn, t.queueLen))
+}
+
+// SetWaitConsumers consumer 队列已满时等待而不是丢弃，用于导入等不允许丢数据的场景，此时慢的 consumer 会阻塞整个任务
+func (t *Task[T]) SetWaitConsumers(wait bool) {
+	t.wait.Store(wait)
 }
-func newTask(name string, channelLen int64, collectTime time.Duration, maxDataLen int) *Task {
-	return &Task{
-		name:        name,
-		collectTime: collectTime,
-		channelLen:  channelLen,
-		collect:     make(chan interface{}, channelLen),
-		data:        make([]interface{}, 0),
-		maxDataLen:  maxDataLen,
-		close:       make(chan chan struct{}, 1),
+
+// Errors consumer 返回错误或 panic 的次数
+func (t *Task[T]) Errors() uint64 {
+	var n uint64
+	for _, c := range t.consumers {
+		n += c.errors.Load()
 	}
+	return n
 }
 
-// SetConsumer 设置消费函数
-func (t *Task) SetConsumer(consumer func([]interface{})) {
-	t.consumer = consumer
+// Stats 当前计数
+func (t *Task[T]) Stats() Stats {
+	stats := Stats{
+		Name:           t.name,
+		Queued:         len(t.collect),
+		Published:      t.published.Load(),
+		Dropped:        t.dropped.Load(),
+		Spilled:        t.spilled.Load(),
+		SinceLastFlush: -1,
+		Consumers:      make([]ConsumerStats, 0, len(t.consumers)),
+	}
+
+	t.batchMu.Lock()
+	stats.Batches = t.batches
+	stats.LastBatchSize = t.lastBatch
+	stats.MaxBatchSize = t.maxBatch
+	if t.batches > 0 {
+		stats.AvgBatchSize = float64(t.batchItems) / float64(t.batches)
+	}
+	t.batchMu.Unlock()
+
+	var flushes uint64
+	var totalFlushMs float64
+	neverFlushed := false
+	for _, c := range t.consumers {
+		cs := c.stats()
+		stats.Consumers = append(stats.Consumers, cs)
+		stats.Dropped += cs.Dropped
+		stats.Flushed += cs.Flushed
+		stats.Failed += cs.Failed
+		stats.Errors += cs.Errors
+		stats.LastFlushMs = math.Max(stats.LastFlushMs, cs.LastFlushMs)
+		stats.MaxFlushMs = math.Max(stats.MaxFlushMs, cs.MaxFlushMs)
+		flushes += cs.Batches
+		totalFlushMs += cs.AvgFlushMs * float64(cs.Batches)
+		if cs.LastSuccess.IsZero() {
+			neverFlushed = true
+		} else if stats.LastSuccess.IsZero() || cs.LastSuccess.Before(stats.LastSuccess) {
+			stats.LastSuccess = cs.LastSuccess
+		}
+	}
+	if flushes > 0 {
+		stats.AvgFlushMs = totalFlushMs / float64(flushes)
+	}
+	if neverFlushed {
+		stats.LastSuccess = time.Time{}
+	} else if !stats.LastSuccess.IsZero() {
+		stats.SinceLastFlush = time.Since(stats.LastSuccess).Seconds()
+	}
+	return stats
 }
 
 // Async 异步执行
-func (t *Task) Async() {
+func (t *Task[T]) Async() {
+	for _, c := range t.consumers {
+		c.start(t.workers)
+	}
 	go func() {
 		defer func() {
 			if err := recover(); err != nil {
@@ -79,56 +222,259 @@ func (t *Task) Async() {
 		for {
 			select {
 			case v := <-t.collect:
-				t.data = append(t.data, v)
-				if t.maxDataLen > 0 && len(t.data) >= t.maxDataLen {
-					tt := t.data
-					t.data = make([]interface{}, 0, len(tt))
-					if len(tt) > 0 {
-						t.callConsumer(tt)
-					}
+				if t.add(v) {
+					t.flush()
 				}
 			case <-t1:
 				// ** 不能判断 len(t.data)==0，有的任务需要依赖当前任务的定时执行
-				tt := t.data
-				t.data = make([]interface{}, 0, len(tt)/2)
-				if len(tt) > 0 {
-					t.callConsumer(tt)
-				}
-			case cc := <-t.close:
+				t.flush()
+				// 重放时 consumer 队列已满则等待，不再接收新数据，新数据按 overflow 策略处理
+				t.unspillWait(t.stopped)
+			case req := <-t.close:
 				// 收到关机信号后，关闭chan，其后产生的消息放弃处理
 				close(t.collect)
-				for v := range t.collect {
-					t.data = append(t.data, v)
-				}
-				if len(t.data) > 0 {
-					t.callConsumer(t.data)
-				}
-				cc <- struct{}{}
-				close(cc)
+				t.drain(req.ctx)
+				close(req.done)
 				return
 			}
 		}
 	}()
 }
 
-// Pub 尽量不要推指针数据进来
-func (t *Task) Pub(b interface{}) (err error) {
-	defer func() {
-		if rec := recover(); rec != nil {
-			fmt.Println("recover pub:", rec)
-			err = errors.New("recover")
+// add 加入当前批次，返回批次是否已达到条数或字节数上限
+func (t *Task[T]) add(v T) bool {
+	t.data = append(t.data, v)
+	if t.maxDataBytes > 0 {
+		t.dataBytes += t.sizeOf(v)
+		if t.dataBytes >= t.maxDataBytes {
+			return true
 		}
-	}()
-	t.collect <- b
-	return nil
+	}
+	return t.maxDataLen > 0 && len(t.data) >= t.maxDataLen
 }
 
-func (t *Task) callConsumer(data []interface{}) {
-	// 不要判断len(data)
-	defer func() {
-		if err := recover(); err != nil {
+// flush 将当前批次放入全部 consumer 的写出队列并开始新的批次，队列已满的 consumer 丢弃这一批
+func (t *Task[T]) flush() {
+	if t.wait.Load() {
+		t.flushWait(context.Background())
+		return
+	}
+	tt := t.next()
+	if len(tt) > 0 {
+		for _, c := range t.consumers {
+			c.offer(tt)
 		}
-	}()
+	}
+}
+
+// flushWait 同 flush，队列已满时等待，ctx 到期后丢弃
+func (t *Task[T]) flushWait(ctx context.Context) {
+	tt := t.next()
+	if len(tt) > 0 {
+		for _, c := range t.consumers {
+			if !c.offerWait(ctx, tt) {
+				c.dropped.Add(uint64(len(tt)))
+			}
+		}
+	}
+}
+
+// replayWait 同 flushWait，ctx 到期后不丢弃，返回全部 consumer 是否都已接收；
+// 未接收的批次仍在溢出文件中，下次重放
+func (t *Task[T]) replayWait(ctx context.Context) bool {
+	tt := t.next()
+	for _, c := range t.consumers {
+		if len(tt) > 0 && !c.offerWait(ctx, tt) {
+			return false
+		}
+	}
+	return true
+}
+
+// next 取出当前批次并开始新的批次
+func (t *Task[T]) next() []T {
+	tt := t.data
+	t.data = make([]T, 0, len(tt))
+	t.dataBytes = 0
+	if len(tt) > 0 {
+		t.batchMu.Lock()
+		t.batches++
+		t.batchItems += uint64(len(tt))
+		t.lastBatch = len(tt)
+		if len(tt) > t.maxBatch {
+			t.maxBatch = len(tt)
+		}
+		t.batchMu.Unlock()
+	}
+	return tt
+}
+
+// unspillWait 消费溢出到磁盘的数据，consumer 队列已满时等待；全部批次都被 consumer 接收后才删除溢出文件，
+// ctx 到期后保留文件，下次从头重放（已接收的部分会重复写出）
+func (t *Task[T]) unspillWait(ctx context.Context) {
+	if t.spill == nil {
+		return
+	}
+	// 先写出当前批次，重放的批次中只有溢出数据
+	t.flushWait(ctx)
+	accepted := true
+	bad, err := t.spill.read(func(v T) bool {
+		if t.add(v) {
+			accepted = t.replayWait(ctx)
+		}
+		return accepted
+	})
+	t.dropped.Add(uint64(bad))
+	if err != nil {
+		fmt.Println("read spill of ", t.name, " err:", err)
+		return
+	}
+	if !accepted || !t.replayWait(ctx) {
+		return
+	}
+	if err := t.spill.remove(); err != nil {
+		fmt.Println("remove spill of ", t.name, " err:", err)
+	}
+}
+
+// drain 按批次消费 channel 中剩余的数据并等待各 consumer 写完，ctx 到期后放弃剩余数据；
+// 未消费的溢出数据留在磁盘上，下次启动时消费
+func (t *Task[T]) drain(ctx context.Context) {
+	for v := range t.collect {
+		if t.add(v) {
+			if ctx.Err() != nil {
+				break
+			}
+			t.flushWait(ctx)
+		}
+	}
+	if ctx.Err() != nil {
+		n := len(t.data) + len(t.collect)
+		t.dropped.Add(uint64(n))
+		fmt.Println("drop ", n, " items of ", t.name, ": ", ctx.Err())
+	} else {
+		t.unspillWait(ctx)
+		t.flushWait(ctx)
+	}
+	for _, c := range t.consumers {
+		if err := c.stop(ctx); err != nil {
+			fmt.Println("stop consumer ", c.name, " of ", t.name, " err:", err)
+		}
+	}
+}
+
+// shutDown 停止接收新数据，发送关闭请求并等待剩余数据消费完成或 ctx 到期
+func (t *Task[T]) shutDown(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		t.stop()
+	}
+	t.mu.Unlock()
+
+	// 等待正在执行的 Pub 返回（阻塞中的已被 stopped 唤醒），之后不会再有数据写入 collect，可以安全关闭
+	if err := WaitGroup(ctx, &t.inflight); err != nil {
+		return err
+	}
+
+	req := closeRequest{ctx: ctx, done: make(chan struct{})}
+	select {
+	case t.close <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-req.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pub 推入一条数据，channel 已满时按 overflow 策略处理，被丢弃时返回 ErrDropped；尽量不要推指针数据进来
+func (t *Task[T]) Pub(b T) error {
+	if !t.enter() {
+		t.dropped.Add(1)
+		return ErrClosed
+	}
+	defer t.inflight.Done()
+	select {
+	case t.collect <- b:
+		t.published.Add(1)
+		return nil
+	default:
+	}
+
+	switch t.overflow {
+	case OverflowDropNewest:
+		t.dropped.Add(1)
+		return ErrDropped
+	case OverflowDropOldest:
+		for {
+			select {
+			case <-t.collect:
+				t.dropped.Add(1)
+			default:
+			}
+			select {
+			case t.collect <- b:
+				t.published.Add(1)
+				return nil
+			default:
+			}
+		}
+	case OverflowSpill:
+		if err := t.spill.write(b); err != nil {
+			t.dropped.Add(1)
+			return err
+		}
+		t.published.Add(1)
+		t.spilled.Add(1)
+		return nil
+	default:
+		timer := time.NewTimer(t.blockTimeout)
+		defer timer.Stop()
+		select {
+		case t.collect <- b:
+			t.published.Add(1)
+			return nil
+		case <-timer.C:
+			t.dropped.Add(1)
+			return ErrDropped
+		case <-t.stopped.Done():
+			t.dropped.Add(1)
+			return ErrClosed
+		}
+	}
+}
+
+// PubWait 忽略 overflow 策略，阻塞直到放入 channel，用于导入等不能丢数据的场景
+func (t *Task[T]) PubWait(b T) error {
+	if !t.enter() {
+		t.dropped.Add(1)
+		return ErrClosed
+	}
+	defer t.inflight.Done()
+	select {
+	case t.collect <- b:
+		t.published.Add(1)
+		return nil
+	case <-t.stopped.Done():
+		t.dropped.Add(1)
+		return ErrClosed
+	}
+}
 
-	t.consumer(data)
+// enter 未关闭时登记一次正在执行的 Pub，调用方返回前需调用 t.inflight.Done
+func (t *Task[T]) enter() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return false
+	}
+	t.inflight.Add(1)
+	return true
 }
@@ -0,0 +1,53 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CollectorConfig 采集器配置
+//
+//	"collectors": [
+//	  {"name": "cpu", "options": {"backend": "proc"}},
+//	  {"name": "pidstat", "options": {"cpu": false}},
+//	  {"name": "io", "interval": 5, "options": {"backend": "proc"}}
+//	]
+type CollectorConfig struct {
+	Name     string          `json:"name"`     // 采集器名称，对应 target.Register 注册的名称
+	Interval int             `json:"interval"` // 采集间隔（秒），默认使用 interval_time
+	Options  json.RawMessage `json:"options"`  // 采集器自身的配置项
+}
+
+// defaultCollectors 未配置 collectors 时，按旧的 *_backend、pidstat_mode 配置生成采集器列表
+func defaultCollectors(sc *ServerConfig) []CollectorConfig {
+	backends := []struct {
+		name    string
+		backend string
+	}{
+		{"cpu", sc.CPUBackend},
+		{"memory", sc.MemBackend},
+		{"io", sc.IOBackend},
+	}
+
+	collectors := make([]CollectorConfig, 0, len(backends)+1)
+	pidstatSections := make(map[string]bool)
+	for _, b := range backends {
+		if sc.PidstatMode == "combined" && b.backend != "proc" {
+			pidstatSections[b.name] = true
+			continue
+		}
+		collectors = append(collectors, CollectorConfig{
+			Name:    b.name,
+			Options: json.RawMessage(fmt.Sprintf(`{"backend":%q}`, b.backend)),
+		})
+	}
+	if len(pidstatSections) > 0 {
+		options, _ := json.Marshal(map[string]bool{
+			"cpu":    pidstatSections["cpu"],
+			"memory": pidstatSections["memory"],
+			"io":     pidstatSections["io"],
+		})
+		collectors = append(collectors, CollectorConfig{Name: "pidstat", Options: options})
+	}
+	return collectors
+}
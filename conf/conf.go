@@ -6,16 +6,31 @@ import (
 )
 
 type ServerConfig struct {
-	IP           string   `json:"ip"`
-	ProcessNames []string `json:"process_names"`
-	IntervalTime int      `json:"interval_time"`
-	DB           struct {
-		User     string `json:"user"`
-		Password string `json:"password"`
-		Host     string `json:"host"`
-		Port     string `json:"port"`
-		Database string `json:"database"`
-	} `json:"db"`
+	IP              string                `json:"ip"`
+	ProcessNames    []ProcessRule         `json:"process_names"`
+	IntervalTime    int                   `json:"interval_time"`
+	CPUBackend      string                `json:"cpu_backend"`      // CPU 采集方式：pidstat（默认）或 proc
+	IOBackend       string                `json:"io_backend"`       // IO 采集方式：pidstat（默认）或 proc
+	MemBackend      string                `json:"memory_backend"`   // 内存采集方式：pidstat（默认）或 proc
+	PidstatMode     string                `json:"pidstat_mode"`     // pidstat 采集方式：默认每类指标一个子进程，combined 为一个子进程同时采集
+	ShutdownTimeout int                   `json:"shutdown_timeout"` // 关机时等待数据写完的最长时间（秒），默认 10
+	Collectors      []CollectorConfig     `json:"collectors"`       // 启用的采集器，未配置时按 *_backend、pidstat_mode 生成
+	Sinks           []SinkConfig          `json:"sinks"`            // 数据输出，未配置时按 db 生成 mysql 输出
+	Spool           SpoolConfig           `json:"spool"`            // 输出写入失败时暂存到磁盘，dir 为空时不启用
+	Tasks           map[string]TaskConfig `json:"tasks"`            // 异步写入任务配置，按任务名称（cpu、memory、io）或 default
+	Status          StatusConfig          `json:"status"`           // HTTP 状态接口与异步任务状态的定期写入
+	Rollup          RollupConfig          `json:"rollup"`           // 1m、5m、1h 汇总表
+	Retention       RetentionConfig       `json:"retention"`        // 按表或粒度清理过期数据
+	DB              DBConfig              `json:"db"`
+}
+
+// DBConfig MySQL 连接配置
+type DBConfig struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Database string `json:"database"`
 }
 
 var Sc *ServerConfig
@@ -30,4 +45,38 @@ func Init() {
 	if err != nil {
 		panic(err)
 	}
+	if len(Sc.Collectors) == 0 {
+		Sc.Collectors = defaultCollectors(Sc)
+	}
+	if Sc.Sinks == nil {
+		Sc.Sinks = defaultSinks(Sc)
+	}
+	if Sc.Status.Interval == 0 {
+		Sc.Status.Interval = 30
+	}
+	if Sc.Rollup.Interval == 0 {
+		Sc.Rollup.Interval = 60
+	}
+	if Sc.Rollup.Delay <= 0 {
+		Sc.Rollup.Delay = 60
+	}
+	if Sc.Retention.Interval == 0 {
+		Sc.Retention.Interval = 3600
+	}
+	if Sc.Retention.ChunkSize <= 0 {
+		Sc.Retention.ChunkSize = 1000
+	}
+	if Sc.Retention.ChunkPause <= 0 {
+		Sc.Retention.ChunkPause = 100
+	}
+	for i := range Sc.Sinks {
+		if Sc.Sinks[i].Name == "" {
+			Sc.Sinks[i].Name = Sc.Sinks[i].Type
+		}
+	}
+	for i := range Sc.Collectors {
+		if Sc.Collectors[i].Interval <= 0 {
+			Sc.Collectors[i].Interval = Sc.IntervalTime
+		}
+	}
 }
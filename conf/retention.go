@@ -0,0 +1,20 @@
+package conf
+
+// RetentionConfig 数据保留配置，按表或粒度保留最近若干天的数据，过期数据分批删除
+//
+//	"retention": {"days": {"raw": 7, "1m": 90, "5m": 180, "task_stats": 30}}
+type RetentionConfig struct {
+	Sink       string         `json:"sink"`        // 清理的 mysql 输出名称，默认第一个 mysql 输出
+	Interval   int            `json:"interval"`    // 采集进程清理本机数据的间隔（秒），默认 3600，小于 0 时不清理
+	ChunkSize  int            `json:"chunk_size"`  // 每条 DELETE 最多删除的行数，默认 1000
+	ChunkPause int            `json:"chunk_pause"` // 两次 DELETE 之间的间隔（毫秒），默认 100
+	Days       map[string]int `json:"days"`        // 保留天数，键为 raw、1m、5m、1h 或表名（优先），未配置或小于等于 0 时永久保留
+}
+
+// KeepDays 一张表的保留天数，表名配置优先于粒度配置，小于等于 0 为永久保留
+func (c RetentionConfig) KeepDays(table, resolution string) int {
+	if days, ok := c.Days[table]; ok {
+		return days
+	}
+	return c.Days[resolution]
+}
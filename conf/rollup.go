@@ -0,0 +1,11 @@
+package conf
+
+// RollupConfig 汇总表配置，将原始数据按 1m、5m、1h 汇总为每个 ip、command 的 count/min/avg/max/p95
+//
+//	"rollup": {"sink": "mysql", "interval": 60, "delay": 60, "resolutions": ["1m", "5m", "1h"]}
+type RollupConfig struct {
+	Sink        string   `json:"sink"`        // 读取原始数据、写入汇总表的 mysql 输出名称，默认第一个 mysql 输出
+	Interval    int      `json:"interval"`    // 采集进程增量汇总本机数据的间隔（秒），默认 60，小于 0 时不汇总
+	Delay       int      `json:"delay"`       // 时间段结束后等待迟到数据的时间（秒），默认 60
+	Resolutions []string `json:"resolutions"` // 汇总粒度，可选 1m、5m、1h，默认全部
+}
@@ -0,0 +1,45 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProcessRule 进程匹配规则，同一条规则中配置的多个条件需要同时满足，多条规则之间为或的关系
+//
+//	"process_names": [
+//	  "mysqld",                                         // 等价于 {"comm": "mysqld"}
+//	  {"comm_regex": "^clickhouse"},
+//	  {"cmdline_regex": "redis-server .*:6379"},
+//	  {"pid_file": "/var/run/mysqld/mysqld.pid"},
+//	  {"comm": "java", "user": "kafka"},
+//	  {"cgroup": "/system.slice/mysqld.service"}
+//	]
+type ProcessRule struct {
+	Comm         string `json:"comm"`          // 进程名（/proc/[pid]/comm）完全相等
+	CommRegex    string `json:"comm_regex"`    // 进程名正则
+	CmdlineRegex string `json:"cmdline_regex"` // 完整命令行（/proc/[pid]/cmdline）正则
+	PIDFile      string `json:"pid_file"`      // PID 文件路径
+	User         string `json:"user"`          // 进程所属用户名或 UID
+	Cgroup       string `json:"cgroup"`        // cgroup 路径前缀
+}
+
+// UnmarshalJSON 兼容旧配置中的纯字符串写法
+func (r *ProcessRule) UnmarshalJSON(data []byte) error {
+	var comm string
+	if err := json.Unmarshal(data, &comm); err == nil {
+		*r = ProcessRule{Comm: comm}
+		return nil
+	}
+
+	type rule ProcessRule
+	var v rule
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid process rule %s: %v", data, err)
+	}
+	*r = ProcessRule(v)
+	if r.Comm == "" && r.CommRegex == "" && r.CmdlineRegex == "" && r.PIDFile == "" && r.User == "" && r.Cgroup == "" {
+		return fmt.Errorf("empty process rule %s", data)
+	}
+	return nil
+}
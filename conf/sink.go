@@ -0,0 +1,35 @@
+package conf
+
+import "encoding/json"
+
+// SinkConfig 数据输出配置，可同时配置多个，每批数据会写入全部输出
+//
+//	"sinks": [
+//	  {"type": "mysql", "options": {"user": "root", "password": "", "host": "127.0.0.1", "port": "3306", "database": "moniter"}},
+//	  {"type": "mysql", "name": "backup", "options": {"host": "10.0.0.2", "port": "3306", "database": "moniter"}}
+//	]
+//
+// 配置为空数组时不输出到任何地方，用于没有数据库的主机
+type SinkConfig struct {
+	Type    string          `json:"type"`    // 输出类型，对应 sink.Register 注册的名称
+	Name    string          `json:"name"`    // 输出名称，用于日志区分同类型的多个输出，默认与 type 相同
+	Options json.RawMessage `json:"options"` // 输出自身的配置项
+}
+
+// SpoolConfig 磁盘暂存配置，输出写入失败的数据暂存到 dir/<输出名称>/ 下，输出恢复后按时间顺序重新写入
+//
+//	"spool": {"dir": "/var/lib/moniter/spool", "max_size": 1024, "replay_interval": 10}
+type SpoolConfig struct {
+	Dir            string `json:"dir"`             // 暂存目录，为空时不暂存，写入失败的数据直接丢弃
+	MaxSize        int    `json:"max_size"`        // 每个输出最多暂存的数据量（MB），超出后删除最旧的数据，默认 1024
+	ReplayInterval int    `json:"replay_interval"` // 检查输出是否恢复的间隔（秒），默认 10
+}
+
+// defaultSinks 未配置 sinks 时，按旧的 db 配置生成 mysql 输出，db.host 为空则不输出
+func defaultSinks(sc *ServerConfig) []SinkConfig {
+	if sc.DB.Host == "" {
+		return []SinkConfig{}
+	}
+	options, _ := json.Marshal(sc.DB)
+	return []SinkConfig{{Type: "mysql", Options: options}}
+}
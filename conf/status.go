@@ -0,0 +1,9 @@
+package conf
+
+// StatusConfig 运行状态配置
+//
+//	"status": {"listen": "127.0.0.1:9257", "interval": 30}
+type StatusConfig struct {
+	Listen   string `json:"listen"`   // HTTP 状态接口监听地址，为空时不监听
+	Interval int    `json:"interval"` // 异步任务状态写入输出的间隔（秒），默认 30，小于 0 时不写入
+}
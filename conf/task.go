@@ -0,0 +1,51 @@
+package conf
+
+// TaskConfig 异步写入任务配置，未配置的字段使用 tasks.default 中的值，再未配置则使用内置默认值
+//
+//	"tasks": {
+//	  "default": {"buffer_size": 5120, "max_batch_len": 1024, "flush_interval": 5},
+//	  "cpu": {"max_batch_bytes": 1048576}
+//	}
+type TaskConfig struct {
+	BufferSize    int    `json:"buffer_size"`     // channel 长度，默认 5120
+	MaxBatchLen   int    `json:"max_batch_len"`   // 每批最多条数，达到后立即写出，默认 1024
+	MaxBatchBytes int    `json:"max_batch_bytes"` // 每批最多字节数（按结构体大小估算），达到后立即写出，默认不限制
+	FlushInterval int    `json:"flush_interval"`  // 定时写出的间隔（秒），默认 5
+	Overflow      string `json:"overflow"`        // channel 已满时的策略：block（默认）、drop_newest、drop_oldest、spill
+	BlockTimeout  int    `json:"block_timeout"`   // overflow 为 block 时的最长等待时间（毫秒），超时后丢弃，默认 1000
+	SpillDir      string `json:"spill_dir"`       // overflow 为 spill 时的溢出目录，默认 ./spill
+	FlushWorkers  int    `json:"flush_workers"`   // 每个 consumer 并发写出的 worker 数，默认 1
+	FlushQueue    int    `json:"flush_queue"`     // 每个 consumer 等待写出的最大批次数，队列已满时丢弃新批次，默认 8
+}
+
+// Merge 用 o 中已配置的字段覆盖 c
+func (c TaskConfig) Merge(o TaskConfig) TaskConfig {
+	if o.BufferSize > 0 {
+		c.BufferSize = o.BufferSize
+	}
+	if o.MaxBatchLen > 0 {
+		c.MaxBatchLen = o.MaxBatchLen
+	}
+	if o.MaxBatchBytes > 0 {
+		c.MaxBatchBytes = o.MaxBatchBytes
+	}
+	if o.FlushInterval > 0 {
+		c.FlushInterval = o.FlushInterval
+	}
+	if o.Overflow != "" {
+		c.Overflow = o.Overflow
+	}
+	if o.BlockTimeout > 0 {
+		c.BlockTimeout = o.BlockTimeout
+	}
+	if o.SpillDir != "" {
+		c.SpillDir = o.SpillDir
+	}
+	if o.FlushWorkers > 0 {
+		c.FlushWorkers = o.FlushWorkers
+	}
+	if o.FlushQueue > 0 {
+		c.FlushQueue = o.FlushQueue
+	}
+	return c
+}
@@ -7,15 +7,21 @@ import (
 	"moniter/conf"
 )
 
-var DBConn *gorm.DB
-
-func Init() {
+// Open 连接 MySQL，连接失败返回错误
+func Open(c conf.DBConfig) (*gorm.DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		conf.Sc.DB.User, conf.Sc.DB.Password, conf.Sc.DB.Host, conf.Sc.DB.Port, conf.Sc.DB.Database)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+		c.User, c.Password, c.Host, c.Port, c.Database)
+	return gorm.Open(mysql.Open(dsn), &gorm.Config{})
+}
+
+// Close 关闭数据库连接池
+func Close(conn *gorm.DB) error {
+	if conn == nil {
+		return nil
+	}
+	sqlDB, err := conn.DB()
 	if err != nil {
-		panic(err)
+		return err
 	}
-
-	DBConn = db
+	return sqlDB.Close()
 }
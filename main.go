@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"moniter/async"
 	"moniter/conf"
-	"moniter/db"
+	"moniter/matcher"
+	"moniter/retention"
+	"moniter/rollup"
+	"moniter/sink"
+	"moniter/status"
+	"moniter/supervisor"
 	"moniter/target"
 	"os"
 	"os/signal"
@@ -26,43 +33,234 @@ func (ProcessMetrics) TableName() string {
 	return "process_metrics"
 }
 
+// printStatuses 输出各采集器、异步任务与增量汇总的运行状态
+func printStatuses() {
+	snapshot := status.Current()
+	for _, c := range snapshot.Collectors {
+		state := "up"
+		if !c.Up {
+			state = fmt.Sprintf("down since %s", c.DownSince.Format(time.DateTime))
+		}
+		fmt.Printf("collector %s: %s, restarts=%d, last_error=%q\n", c.Name, state, c.Restarts, c.LastError)
+	}
+	for _, t := range snapshot.Tasks {
+		fmt.Printf("task %s: queued=%d, published=%d, dropped=%d, flushed=%d, failed=%d, avg_flush_ms=%.1f, since_last_flush=%.0fs\n",
+			t.Name, t.Queued, t.Published, t.Dropped, t.Flushed, t.Failed, t.AvgFlushMs, t.SinceLastFlush)
+	}
+	if r := snapshot.Rollup; r.Enabled {
+		fmt.Printf("rollup: last_run=%s, rows=%d, last_error=%q\n", r.LastRun.Format(time.DateTime), r.Rows, r.LastError)
+	}
+}
+
+// runRollup 无参数时从上次的进度汇总全部主机的数据，指定 from、to（2006-01-02 或 2006-01-02 15:04:05）时重算该时间段，
+// index 为原始表建汇总所需的索引
+func runRollup(args []string) error {
+	ctx := context.Background()
+	var n int
+	var err error
+	switch {
+	case len(args) == 1 && args[0] == "index":
+		return rollup.CreateIndexes(ctx, conf.Sc.Rollup)
+	case len(args) == 0:
+		n, err = rollup.Catchup(ctx, conf.Sc.Rollup, nil)
+	case len(args) == 2:
+		from, ferr := parseTime(args[0])
+		to, terr := parseTime(args[1])
+		if ferr != nil || terr != nil {
+			return fmt.Errorf("invalid time range %q %q", args[0], args[1])
+		}
+		n, err = rollup.Recompute(ctx, conf.Sc.Rollup, from, to)
+	default:
+		fmt.Println("usage: moniter rollup [index | <from> <to>]")
+		os.Exit(2)
+	}
+	log.Printf("rolled up %d rows", n)
+	return err
+}
+
+// runPurge 无参数时按保留策略清理全部主机的过期数据，index 为各表建清理所需的索引
+func runPurge(args []string) error {
+	ctx := context.Background()
+	switch {
+	case len(args) == 1 && args[0] == "index":
+		return retention.CreateIndexes(ctx, conf.Sc.Retention)
+	case len(args) == 0:
+	default:
+		fmt.Println("usage: moniter purge [index]")
+		os.Exit(2)
+	}
+	n, err := retention.Purge(ctx, conf.Sc.Retention, "")
+	log.Printf("purged %d rows", n)
+	return err
+}
+
+// parseTime 解析本地时间，支持 2006-01-02 与 2006-01-02 15:04:05
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateTime, s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, time.Local)
+}
+
+// startCollectors 按配置创建并启动采集器
+func startCollectors(ctx context.Context, processMatcher *matcher.Matcher) {
+	for _, c := range conf.Sc.Collectors {
+		collector, err := target.NewCollector(c.Name, target.CollectorConfig{
+			Matcher:  processMatcher,
+			Interval: c.Interval,
+			Options:  c.Options,
+		})
+		if err != nil {
+			panic(err)
+		}
+		supervisor.New(c.Name, collector.StartMonitoring).Start(ctx)
+	}
+}
+
+// shutDown 按顺序关机：停止采集器（结束 pidstat 子进程）、状态写入、增量汇总与过期数据清理、消费完 channel 中剩余的数据、关闭输出
+func shutDown(stopCollectors context.CancelFunc) {
+	timeout := time.Duration(conf.Sc.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopCollectors()
+	if err := supervisor.Wait(ctx); err != nil {
+		fmt.Println("stop collectors:", err)
+	}
+	if err := status.Wait(ctx); err != nil {
+		fmt.Println("stop status:", err)
+	}
+	if err := rollup.Wait(ctx); err != nil {
+		fmt.Println("stop rollup:", err)
+	}
+	if err := retention.Wait(ctx); err != nil {
+		fmt.Println("stop retention:", err)
+	}
+
+	// 将留在channel中的数据消费完
+	if err := async.ShutDown(ctx); err != nil {
+		fmt.Println("shutdown async tasks:", err)
+	}
+
+	if err := sink.Close(); err != nil {
+		fmt.Println("close sinks:", err)
+	}
+}
+
 func init() {
 	conf.Init()
-	db.Init()
-
+	if err := sink.Init(conf.Sc.Sinks, conf.Sc.Spool); err != nil {
+		panic(err)
+	}
 }
 
 func main() {
-	// 监控的进程名列表
-	processNames := conf.Sc.ProcessNames
-
-	// 创建监控器实例（1秒间隔）
-	cpuMonitor := target.NewCPUMonitor(processNames, conf.Sc.IntervalTime)
-	memoryMonitor := target.NewMemoryMonitor(processNames, conf.Sc.IntervalTime)
-	ioMonitor := target.NewIOMonitor(processNames, conf.Sc.IntervalTime)
-	go func() {
-		fmt.Println("开始监控进程")
-		cpuMonitor.StartMonitoring()
-	}()
+	// 监控的进程匹配规则
+	processMatcher, err := matcher.New(conf.Sc.ProcessNames)
+	if err != nil {
+		panic(err)
+	}
+
+	// moniter import <file>... 导入保存的 pidstat 日志
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if len(os.Args) < 3 {
+			fmt.Println("usage: moniter import <pidstat.log>...")
+			os.Exit(2)
+		}
+		failed := false
+		if err := target.ImportFiles(processMatcher, os.Args[2:]); err != nil {
+			fmt.Println("import failed:", err)
+			failed = true
+		}
+		// 导入需要等待全部数据写完
+		if err := async.ShutDown(context.Background()); err != nil {
+			fmt.Println("shutdown async tasks:", err)
+			failed = true
+		}
+		if err := target.ImportFailures(); err != nil {
+			fmt.Println("import failed:", err)
+			failed = true
+		}
+		if err := sink.Close(); err != nil {
+			fmt.Println("close sinks:", err)
+			failed = true
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// moniter purge [index] 按保留策略清理全部主机的过期数据，或建清理所需的索引
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		err := runPurge(os.Args[2:])
+		if err != nil {
+			fmt.Println("purge failed:", err)
+		}
+		sink.Close()
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// moniter partition 将已有数据的 process_*_stats 表迁移为按天分区
+	if len(os.Args) > 1 && os.Args[1] == "partition" {
+		err := sink.MigratePartitions()
+		if err != nil {
+			fmt.Println("partition failed:", err)
+		}
+		sink.Close()
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// moniter rollup [<from> <to>] 汇总全部主机的数据，或重算指定时间段
+	if len(os.Args) > 1 && os.Args[1] == "rollup" {
+		err := runRollup(os.Args[2:])
+		if err != nil {
+			fmt.Println("rollup failed:", err)
+		}
+		sink.Close()
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 采集器退出后按指数退避自动重启，ctx 取消后停止
+	ctx, cancel := context.WithCancel(context.Background())
+	startCollectors(ctx, processMatcher)
+	if err := status.Start(ctx, conf.Sc.Status); err != nil {
+		panic(err)
+	}
+	if err := rollup.Start(ctx, conf.Sc.Rollup); err != nil {
+		panic(err)
+	}
+	if err := retention.Start(ctx, conf.Sc.Retention); err != nil {
+		panic(err)
+	}
 
-	go func() {
-		fmt.Println("开始监控内存")
-		memoryMonitor.StartMonitoring()
-	}()
-	go func() {
-		fmt.Println("开始监控IO")
-		ioMonitor.StartMonitoring()
-	}()
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
 	defer func() {
 		signal.Stop(ch)
 		close(ch)
 	}()
-	<-ch
+	// SIGUSR1 输出采集器、异步任务与增量汇总状态，其余信号退出
+	for sig := range ch {
+		if sig != syscall.SIGUSR1 {
+			break
+		}
+		printStatuses()
+	}
 
-	// 将留在channel中的数据消费完
-	async.ShutDown()
+	shutDown(cancel)
 
 	//// 每秒采集一次数据
 	//ticker := time.NewTicker(3 * time.Second)
@@ -0,0 +1,170 @@
+package matcher
+
+import (
+	"bufio"
+	"fmt"
+	"moniter/conf"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// commLen 内核中 comm 的最大长度（不含结尾的 \0）
+const commLen = 15
+
+// procRoot proc 文件系统挂载点
+const procRoot = "/proc"
+
+// Process 待匹配的进程信息
+type Process struct {
+	PID     int
+	Comm    string // 进程名
+	User    string // 用户名或 UID，pidstat 输出的是 UID
+	Cmdline string // 完整命令行，为空时实时模式下从 /proc 读取
+}
+
+// rule 编译后的匹配规则
+type rule struct {
+	conf.ProcessRule
+	commRegex    *regexp.Regexp
+	cmdlineRegex *regexp.Regexp
+	uid          string // User 对应的 UID
+}
+
+// Matcher 进程匹配器
+type Matcher struct {
+	rules []rule
+}
+
+// New 编译配置中的匹配规则
+func New(rules []conf.ProcessRule) (*Matcher, error) {
+	m := &Matcher{rules: make([]rule, 0, len(rules))}
+	for _, r := range rules {
+		compiled := rule{ProcessRule: r}
+		var err error
+		if r.CommRegex != "" {
+			if compiled.commRegex, err = regexp.Compile(r.CommRegex); err != nil {
+				return nil, fmt.Errorf("invalid comm_regex %q: %v", r.CommRegex, err)
+			}
+		}
+		if r.CmdlineRegex != "" {
+			if compiled.cmdlineRegex, err = regexp.Compile(r.CmdlineRegex); err != nil {
+				return nil, fmt.Errorf("invalid cmdline_regex %q: %v", r.CmdlineRegex, err)
+			}
+		}
+		if r.User != "" {
+			compiled.uid = r.User
+			if u, err := user.Lookup(r.User); err == nil {
+				compiled.uid = u.Uid
+			}
+		}
+		m.rules = append(m.rules, compiled)
+	}
+	return m, nil
+}
+
+// Empty 是否没有配置任何规则
+func (m *Matcher) Empty() bool {
+	return len(m.rules) == 0
+}
+
+// Match 实时模式下判断进程是否命中任一规则，按需读取 /proc 中的命令行、cgroup 与 PID 文件
+func (m *Matcher) Match(p Process) bool {
+	for _, r := range m.rules {
+		if r.match(&p, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchOffline 离线导入时判断进程是否命中任一规则，只使用 pidstat 输出中已有的信息，
+// 依赖本机 /proc 的 pid_file、cgroup 条件视为不满足
+func (m *Matcher) MatchOffline(p Process) bool {
+	for _, r := range m.rules {
+		if r.match(&p, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// match 判断规则中的所有条件是否都满足
+func (r *rule) match(p *Process, live bool) bool {
+	if r.Comm != "" && !matchComm(r.Comm, p.Comm) {
+		return false
+	}
+	if r.commRegex != nil && !r.commRegex.MatchString(p.Comm) {
+		return false
+	}
+	if r.User != "" && p.User != r.User && p.User != r.uid {
+		return false
+	}
+	if r.cmdlineRegex != nil {
+		if p.Cmdline == "" && live {
+			p.Cmdline = readCmdline(p.PID)
+		}
+		if !r.cmdlineRegex.MatchString(p.Cmdline) {
+			return false
+		}
+	}
+	if r.PIDFile != "" && (!live || readPIDFile(r.PIDFile) != p.PID) {
+		return false
+	}
+	if r.Cgroup != "" && (!live || !inCgroup(p.PID, r.Cgroup)) {
+		return false
+	}
+	return true
+}
+
+// matchComm 进程名完全相等，内核会把 comm 截断到 15 个字符
+func matchComm(want, comm string) bool {
+	if want == comm {
+		return true
+	}
+	return len(comm) == commLen && strings.HasPrefix(want, comm)
+}
+
+// readCmdline 读取 /proc/[pid]/cmdline，参数之间以空格分隔
+func readCmdline(pid int) string {
+	b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(b), "\x00", " "))
+}
+
+// readPIDFile 读取 PID 文件，读取失败返回 0
+func readPIDFile(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// inCgroup 判断进程是否位于指定的 cgroup 路径或其子路径下（兼容 cgroup v1 与 v2）
+func inCgroup(pid int, path string) bool {
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) == 3 && (parts[2] == path || strings.HasPrefix(parts[2], strings.TrimSuffix(path, "/")+"/")) {
+			return true
+		}
+	}
+	return false
+}
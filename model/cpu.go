@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// ProcessCPUStats 存储进程 CPU 统计信息
+type ProcessCPUStats struct {
+	ID        uint      `gorm:"primaryKey"` // 主键
+	IP        string    `gorm:"type:varchar(50);not null"`
+	Timestamp time.Time `gorm:"type:datetime"`          // 时间戳
+	PID       int       `gorm:"column:pid;not null"`    // 进程 ID
+	User      string    `gorm:"column:user;not null"`   // 用户名
+	USR       float64   `gorm:"column:usr;not null"`    // 用户空间 CPU 使用率
+	System    float64   `gorm:"column:system;not null"` // 系统空间 CPU 使用率
+	Guest     float64   `gorm:"column:guest;not null"`  // 虚拟 CPU 使用率
+	Wait      float64   `gorm:"column:wait;not null"`
+	Total     float64   `gorm:"column:total;not null"`   // 总 CPU 使用率
+	Command   string    `gorm:"column:command;not null"` // 命令
+}
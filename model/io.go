@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// ProcessIOStats 存储进程 IO 统计信息
+type ProcessIOStats struct {
+	ID        uint      `gorm:"primaryKey"`    // 主键
+	Timestamp time.Time `gorm:"type:datetime"` // 时间戳
+	IP        string    `gorm:"type:varchar(50);not null"`
+	PID       int       `gorm:"column:pid;not null"`                  // 进程 ID
+	User      string    `gorm:"column:user;not null"`                 // 用户名
+	ReadKBPS  float64   `gorm:"column:read_kbps;not null"`            // 每秒读取 KB
+	WriteKBPS float64   `gorm:"column:write_kbps;not null"`           // 每秒写入 KB
+	KBCCWR    float64   `gorm:"column:kbccwr;not null"`               // 每秒读取操作次数
+	IODelay   float64   `gorm:"column:io_delay;not null"`             // 每秒写入操作次数
+	RCharKBPS float64   `gorm:"column:rchar_kbps;not null;default:0"` // 每秒逻辑读取 KB（含页缓存）
+	WCharKBPS float64   `gorm:"column:wchar_kbps;not null;default:0"` // 每秒逻辑写入 KB（含页缓存）
+	SyscRPS   float64   `gorm:"column:syscr_ps;not null;default:0"`   // 每秒读系统调用次数
+	SyscWPS   float64   `gorm:"column:syscw_ps;not null;default:0"`   // 每秒写系统调用次数
+	Command   string    `gorm:"column:command;not null"`              // 命令
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// ProcessMemStats 存储进程内存统计信息
+type ProcessMemStats struct {
+	ID            uint      `gorm:"primaryKey"` // 主键
+	IP            string    `gorm:"type:varchar(50);not null"`
+	Timestamp     time.Time `gorm:"type:datetime"`                             // 时间戳
+	PID           int       `gorm:"column:pid;not null"`                       // 进程 ID
+	User          string    `gorm:"column:user;not null"`                      // 用户名
+	MinorFaults   float64   `gorm:"column:minor_faults;not null"`              // 次缺页错误
+	MajorFaults   float64   `gorm:"column:major_faults;not null"`              // 主缺页错误
+	VSZ           float64   `gorm:"column:vsz;not null"`                       // 虚拟内存大小 (KB)
+	RSS           float64   `gorm:"column:rss;not null"`                       // 物理内存大小 (KB)
+	PSS           float64   `gorm:"column:pss;not null;default:0"`             // 按共享进程数均摊后的物理内存 (KB)
+	USS           float64   `gorm:"column:uss;not null;default:0"`             // 进程独占的物理内存 (KB)
+	Swap          float64   `gorm:"column:swap;not null;default:0"`            // 被换出到 swap 的内存 (KB)
+	RssAnon       float64   `gorm:"column:rss_anon;not null;default:0"`        // 匿名页 RSS (KB)
+	RssFile       float64   `gorm:"column:rss_file;not null;default:0"`        // 文件映射 RSS (KB)
+	RssShmem      float64   `gorm:"column:rss_shmem;not null;default:0"`       // 共享内存 RSS (KB)
+	AnonHugePages float64   `gorm:"column:anon_huge_pages;not null;default:0"` // 透明大页 (KB)
+	HugetlbPages  float64   `gorm:"column:hugetlb_pages;not null;default:0"`   // hugetlbfs 大页 (KB)
+	Command       string    `gorm:"column:command;not null"`                   // 命令
+}
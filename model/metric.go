@@ -0,0 +1,242 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 数据类型
+const (
+	KindCPU    = "cpu"
+	KindMemory = "memory"
+	KindIO     = "io"
+	KindTask   = "task" // 异步写入任务自身的运行状态
+)
+
+// Field 数值列
+type Field struct {
+	Name string // 列名
+	Help string // 说明
+}
+
+// Tags 标识一个进程的标签
+type Tags struct {
+	IP      string
+	PID     int
+	User    string
+	Command string
+}
+
+// Pairs 按名称排序的非空标签，PID 为 0 时省略
+func (t Tags) Pairs() [][2]string {
+	pairs := make([][2]string, 0, 4)
+	for _, pair := range [][2]string{
+		{"command", t.Command},
+		{"ip", t.IP},
+		{"pid", strconv.Itoa(t.PID)},
+		{"user", t.User},
+	} {
+		if pair[1] == "" || (pair[0] == "pid" && t.PID == 0) {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+// Metric 一行采集数据的通用视图，供 Prometheus、InfluxDB 等输出按列遍历
+type Metric interface {
+	// Kind 数据类型：cpu、memory、io、task
+	Kind() string
+	// Tags 进程标签
+	Tags() Tags
+	// Time 采样时间
+	Time() time.Time
+	// Fields 数值列，与 Values 一一对应
+	Fields() []Field
+	// Values 数值列的值
+	Values() []float64
+}
+
+var cpuFields = []Field{
+	{"usr", "用户空间 CPU 使用率 (%)"},
+	{"system", "系统空间 CPU 使用率 (%)"},
+	{"guest", "虚拟 CPU 使用率 (%)"},
+	{"wait", "等待运行的 CPU 占比 (%)"},
+	{"total", "总 CPU 使用率 (%)"},
+}
+
+var memoryFields = []Field{
+	{"minor_faults", "每秒次缺页错误"},
+	{"major_faults", "每秒主缺页错误"},
+	{"vsz", "虚拟内存大小 (KB)"},
+	{"rss", "物理内存大小 (KB)"},
+	{"pss", "按共享进程数均摊后的物理内存 (KB)"},
+	{"uss", "进程独占的物理内存 (KB)"},
+	{"swap", "被换出到 swap 的内存 (KB)"},
+	{"rss_anon", "匿名页 RSS (KB)"},
+	{"rss_file", "文件映射 RSS (KB)"},
+	{"rss_shmem", "共享内存 RSS (KB)"},
+	{"anon_huge_pages", "透明大页 (KB)"},
+	{"hugetlb_pages", "hugetlbfs 大页 (KB)"},
+}
+
+var ioFields = []Field{
+	{"read_kbps", "每秒读取 KB"},
+	{"write_kbps", "每秒写入 KB"},
+	{"kbccwr", "每秒取消写入 KB"},
+	{"io_delay", "块 IO 等待时钟周期"},
+	{"rchar_kbps", "每秒逻辑读取 KB（含页缓存）"},
+	{"wchar_kbps", "每秒逻辑写入 KB（含页缓存）"},
+	{"syscr_ps", "每秒读系统调用次数"},
+	{"syscw_ps", "每秒写系统调用次数"},
+}
+
+func (s ProcessCPUStats) Kind() string    { return KindCPU }
+func (s ProcessCPUStats) Tags() Tags      { return Tags{s.IP, s.PID, s.User, s.Command} }
+func (s ProcessCPUStats) Time() time.Time { return s.Timestamp }
+func (s ProcessCPUStats) Fields() []Field { return cpuFields }
+func (s ProcessCPUStats) Values() []float64 {
+	return []float64{s.USR, s.System, s.Guest, s.Wait, s.Total}
+}
+
+func (s ProcessMemStats) Kind() string    { return KindMemory }
+func (s ProcessMemStats) Tags() Tags      { return Tags{s.IP, s.PID, s.User, s.Command} }
+func (s ProcessMemStats) Time() time.Time { return s.Timestamp }
+func (s ProcessMemStats) Fields() []Field { return memoryFields }
+func (s ProcessMemStats) Values() []float64 {
+	return []float64{s.MinorFaults, s.MajorFaults, s.VSZ, s.RSS, s.PSS, s.USS, s.Swap,
+		s.RssAnon, s.RssFile, s.RssShmem, s.AnonHugePages, s.HugetlbPages}
+}
+
+func (s ProcessIOStats) Kind() string    { return KindIO }
+func (s ProcessIOStats) Tags() Tags      { return Tags{s.IP, s.PID, s.User, s.Command} }
+func (s ProcessIOStats) Time() time.Time { return s.Timestamp }
+func (s ProcessIOStats) Fields() []Field { return ioFields }
+func (s ProcessIOStats) Values() []float64 {
+	return []float64{s.ReadKBPS, s.WriteKBPS, s.KBCCWR, s.IODelay, s.RCharKBPS, s.WCharKBPS, s.SyscRPS, s.SyscWPS}
+}
+
+// Metrics 将 Sink.Write 收到的一批数据转为通用视图
+func Metrics(rows interface{}) ([]Metric, error) {
+	var metrics []Metric
+	switch rows := rows.(type) {
+	case []ProcessCPUStats:
+		metrics = make([]Metric, len(rows))
+		for i := range rows {
+			metrics[i] = rows[i]
+		}
+	case []ProcessMemStats:
+		metrics = make([]Metric, len(rows))
+		for i := range rows {
+			metrics[i] = rows[i]
+		}
+	case []ProcessIOStats:
+		metrics = make([]Metric, len(rows))
+		for i := range rows {
+			metrics[i] = rows[i]
+		}
+	case []TaskStats:
+		metrics = make([]Metric, len(rows))
+		for i := range rows {
+			metrics[i] = rows[i]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported rows type %T", rows)
+	}
+	return metrics, nil
+}
+
+// KindFields 数据类型的数值列，未知类型返回 nil
+func KindFields(kind string) []Field {
+	switch kind {
+	case KindCPU:
+		return cpuFields
+	case KindMemory:
+		return memoryFields
+	case KindIO:
+		return ioFields
+	case KindTask:
+		return taskFields
+	}
+	return nil
+}
+
+// NewMetric 按数据类型构造一行数据，values 与 KindFields(kind) 一一对应
+func NewMetric(kind string, tags Tags, ts time.Time, values []float64) (Metric, error) {
+	fields := KindFields(kind)
+	if fields == nil {
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	if len(values) != len(fields) {
+		return nil, fmt.Errorf("%s expects %d values, got %d", kind, len(fields), len(values))
+	}
+	v := values
+	switch kind {
+	case KindCPU:
+		return ProcessCPUStats{IP: tags.IP, Timestamp: ts, PID: tags.PID, User: tags.User, Command: tags.Command,
+			USR: v[0], System: v[1], Guest: v[2], Wait: v[3], Total: v[4]}, nil
+	case KindMemory:
+		return ProcessMemStats{IP: tags.IP, Timestamp: ts, PID: tags.PID, User: tags.User, Command: tags.Command,
+			MinorFaults: v[0], MajorFaults: v[1], VSZ: v[2], RSS: v[3], PSS: v[4], USS: v[5], Swap: v[6],
+			RssAnon: v[7], RssFile: v[8], RssShmem: v[9], AnonHugePages: v[10], HugetlbPages: v[11]}, nil
+	case KindIO:
+		return ProcessIOStats{IP: tags.IP, Timestamp: ts, PID: tags.PID, User: tags.User, Command: tags.Command,
+			ReadKBPS: v[0], WriteKBPS: v[1], KBCCWR: v[2], IODelay: v[3], RCharKBPS: v[4], WCharKBPS: v[5], SyscRPS: v[6], SyscWPS: v[7]}, nil
+	default:
+		return TaskStats{IP: tags.IP, Timestamp: ts, Task: tags.Command,
+			Queued: v[0], Published: v[1], Dropped: v[2], Spilled: v[3], Flushed: v[4], Failed: v[5], Errors: v[6], Batches: v[7],
+			LastBatchSize: v[8], MaxBatchSize: v[9], AvgBatchSize: v[10], LastFlushMs: v[11], MaxFlushMs: v[12], AvgFlushMs: v[13], SinceLastFlush: v[14]}, nil
+	}
+}
+
+// Rows 将同一类型的通用视图转回 Sink.Write 接收的切片
+func Rows(metrics []Metric) (interface{}, error) {
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("no rows")
+	}
+	switch metrics[0].(type) {
+	case ProcessCPUStats:
+		rows := make([]ProcessCPUStats, 0, len(metrics))
+		for _, m := range metrics {
+			row, ok := m.(ProcessCPUStats)
+			if !ok {
+				return nil, fmt.Errorf("mixed row types %T and %T", metrics[0], m)
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	case ProcessMemStats:
+		rows := make([]ProcessMemStats, 0, len(metrics))
+		for _, m := range metrics {
+			row, ok := m.(ProcessMemStats)
+			if !ok {
+				return nil, fmt.Errorf("mixed row types %T and %T", metrics[0], m)
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	case ProcessIOStats:
+		rows := make([]ProcessIOStats, 0, len(metrics))
+		for _, m := range metrics {
+			row, ok := m.(ProcessIOStats)
+			if !ok {
+				return nil, fmt.Errorf("mixed row types %T and %T", metrics[0], m)
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	case TaskStats:
+		rows := make([]TaskStats, 0, len(metrics))
+		for _, m := range metrics {
+			row, ok := m.(TaskStats)
+			if !ok {
+				return nil, fmt.Errorf("mixed row types %T and %T", metrics[0], m)
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unsupported row type %T", metrics[0])
+}
@@ -0,0 +1,7 @@
+// Package model 采集数据的表结构，供采集器与各个 Sink 共用
+package model
+
+// Tables 需要建表的全部数据结构
+func Tables() []interface{} {
+	return []interface{}{&ProcessCPUStats{}, &ProcessMemStats{}, &ProcessIOStats{}, &TaskStats{}}
+}
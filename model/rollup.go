@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Rollup 一个时间段内同一 ip、command（含不同 PID）某一数值列的汇总，
+// 每类数据、每个粒度一张表，如 process_cpu_stats_1m
+type Rollup struct {
+	ID        uint      `gorm:"primaryKey"` // 主键
+	IP        string    `gorm:"type:varchar(50);not null;uniqueIndex:uk_rollup,priority:1;index:idx_ip_timestamp,priority:1"`
+	Command   string    `gorm:"column:command;type:varchar(255);not null;uniqueIndex:uk_rollup,priority:2"`                                    // 命令
+	Field     string    `gorm:"column:field;type:varchar(32);not null;uniqueIndex:uk_rollup,priority:3"`                                       // 数值列名
+	Timestamp time.Time `gorm:"type:datetime;not null;uniqueIndex:uk_rollup,priority:4;index:idx_timestamp;index:idx_ip_timestamp,priority:2"` // 时间段开始时间
+	Count     int       `gorm:"column:count;not null"`                                                                                         // 样本数
+	Min       float64   `gorm:"column:min;not null"`                                                                                           // 最小值
+	Avg       float64   `gorm:"column:avg;not null"`                                                                                           // 平均值
+	Max       float64   `gorm:"column:max;not null"`                                                                                           // 最大值
+	P95       float64   `gorm:"column:p95;not null"`                                                                                           // 95 分位数
+}
+
+// RollupState 增量汇总的进度，每个 ip、数据类型、粒度一行
+type RollupState struct {
+	IP         string    `gorm:"primaryKey;type:varchar(50)"`
+	Kind       string    `gorm:"primaryKey;type:varchar(16)"` // 数据类型：cpu、memory、io
+	Resolution string    `gorm:"primaryKey;type:varchar(8)"`  // 汇总粒度：1m、5m、1h
+	Done       time.Time `gorm:"type:datetime;not null"`      // 该时间之前的时间段已汇总
+}
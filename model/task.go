@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// TaskStats 异步写入任务的运行状态，定期写入输出，写入积压、输出卡住时可以及早发现
+type TaskStats struct {
+	ID             uint      `gorm:"primaryKey"` // 主键
+	IP             string    `gorm:"type:varchar(50);not null"`
+	Timestamp      time.Time `gorm:"type:datetime"`                         // 时间戳
+	Task           string    `gorm:"column:task;type:varchar(50);not null"` // 任务名称
+	Queued         float64   `gorm:"column:queued;not null"`                // channel 中等待处理的条数
+	Published      float64   `gorm:"column:published;not null"`             // 累计接收的条数
+	Dropped        float64   `gorm:"column:dropped;not null"`               // 累计丢弃的条数
+	Spilled        float64   `gorm:"column:spilled;not null"`               // 累计溢出到磁盘的条数
+	Flushed        float64   `gorm:"column:flushed;not null"`               // 累计写出成功的条数
+	Failed         float64   `gorm:"column:failed;not null"`                // 累计写出失败的条数
+	Errors         float64   `gorm:"column:errors;not null"`                // 累计写出失败的批次数
+	Batches        float64   `gorm:"column:batches;not null"`               // 累计写出的批次数
+	LastBatchSize  float64   `gorm:"column:last_batch_size;not null"`       // 最近一批的条数
+	MaxBatchSize   float64   `gorm:"column:max_batch_size;not null"`        // 最大一批的条数
+	AvgBatchSize   float64   `gorm:"column:avg_batch_size;not null"`        // 平均每批条数
+	LastFlushMs    float64   `gorm:"column:last_flush_ms;not null"`         // 最近一批的写出耗时（毫秒）
+	MaxFlushMs     float64   `gorm:"column:max_flush_ms;not null"`          // 最大写出耗时（毫秒）
+	AvgFlushMs     float64   `gorm:"column:avg_flush_ms;not null"`          // 平均写出耗时（毫秒）
+	SinceLastFlush float64   `gorm:"column:since_last_flush;not null"`      // 距最近一次写出成功的秒数，从未成功为 -1
+}
+
+var taskFields = []Field{
+	{"queued", "channel 中等待处理的条数"},
+	{"published", "累计接收的条数"},
+	{"dropped", "累计丢弃的条数"},
+	{"spilled", "累计溢出到磁盘的条数"},
+	{"flushed", "累计写出成功的条数"},
+	{"failed", "累计写出失败的条数"},
+	{"errors", "累计写出失败的批次数"},
+	{"batches", "累计写出的批次数"},
+	{"last_batch_size", "最近一批的条数"},
+	{"max_batch_size", "最大一批的条数"},
+	{"avg_batch_size", "平均每批条数"},
+	{"last_flush_ms", "最近一批的写出耗时 (ms)"},
+	{"max_flush_ms", "最大写出耗时 (ms)"},
+	{"avg_flush_ms", "平均写出耗时 (ms)"},
+	{"since_last_flush", "距最近一次写出成功的秒数，从未成功为 -1"},
+}
+
+// TaskStats 没有进程信息，标签中 command 为任务名称
+
+func (s TaskStats) Kind() string    { return KindTask }
+func (s TaskStats) Tags() Tags      { return Tags{IP: s.IP, Command: s.Task} }
+func (s TaskStats) Time() time.Time { return s.Timestamp }
+func (s TaskStats) Fields() []Field { return taskFields }
+func (s TaskStats) Values() []float64 {
+	return []float64{s.Queued, s.Published, s.Dropped, s.Spilled, s.Flushed, s.Failed, s.Errors, s.Batches,
+		s.LastBatchSize, s.MaxBatchSize, s.AvgBatchSize, s.LastFlushMs, s.MaxFlushMs, s.AvgFlushMs, s.SinceLastFlush}
+}
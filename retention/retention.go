@@ -0,0 +1,230 @@
+// Package retention 按表或汇总粒度清理过期数据，每批先按索引查出一小批过期行的主键再按主键删除，
+// 并间隔一段时间，不扫描全表、不长时间锁表、不影响采集数据的写入
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"moniter/async"
+	"moniter/conf"
+	"moniter/rollup"
+	"moniter/sink"
+	"sync"
+	"time"
+)
+
+// running 定期清理的 goroutine
+var running sync.WaitGroup
+
+const (
+	// hostIndex 按主机清理所用的 (ip, timestamp) 索引，与汇总读取原始表的索引相同
+	hostIndex = "idx_ip_timestamp"
+	// timeIndex 清理全部主机所用的 timestamp 索引
+	timeIndex = "idx_timestamp"
+)
+
+// indexColumns 清理所用索引的列
+var indexColumns = map[string]string{
+	hostIndex: "`ip`, `timestamp`",
+	timeIndex: "`timestamp`",
+}
+
+// Policy 一张表的保留策略
+type Policy struct {
+	Table string        // 表名
+	Keep  time.Duration // 保留时长
+}
+
+// Policies 按配置生成各表的保留策略，永久保留的表不在其中；表名配置优先于粒度配置
+func Policies(c conf.RetentionConfig) []Policy {
+	tables := append(rollup.Tables(), rollup.Table{Name: "task_stats", Resolution: "raw"})
+	policies := make([]Policy, 0, len(tables))
+	for _, t := range tables {
+		if days := c.KeepDays(t.Name, t.Resolution); days > 0 {
+			policies = append(policies, Policy{t.Name, time.Duration(days) * 24 * time.Hour})
+		}
+	}
+	return policies
+}
+
+// Start 按配置每 interval 秒清理一次本机（conf.Sc.IP）的过期数据，ctx 取消后停止；
+// 没有配置保留天数或没有 mysql 输出时不清理
+func Start(ctx context.Context, c conf.RetentionConfig) error {
+	if c.Interval <= 0 || len(Policies(c)) == 0 {
+		return nil
+	}
+	if sink.FindMySQL(c.Sink) == nil {
+		if c.Sink != "" {
+			return fmt.Errorf("retention sink %q is not a mysql sink", c.Sink)
+		}
+		log.Printf("retention disabled: no mysql sink")
+		return nil
+	}
+
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		ticker := time.NewTicker(time.Duration(c.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := Purge(ctx, c, conf.Sc.IP); err != nil && ctx.Err() == nil {
+					log.Printf("retention Purge ,err : %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Wait 等待定期清理退出（需先取消 Start 时传入的 ctx），关闭输出前调用；ctx 到期后返回 ctx 的错误
+func Wait(ctx context.Context) error {
+	return async.WaitGroup(ctx, &running)
+}
+
+// Purge 按保留策略删除过期数据，ip 为空时清理全部主机，返回删除的行数；不存在的表跳过，
+// 缺少清理所需索引且已有数据的表跳过并返回错误
+func Purge(ctx context.Context, c conf.RetentionConfig, ip string) (int64, error) {
+	m := sink.FindMySQL(c.Sink)
+	if m == nil {
+		return 0, fmt.Errorf("no mysql sink %q", c.Sink)
+	}
+	conn, err := m.DB()
+	if err != nil {
+		return 0, err
+	}
+	conn = conn.WithContext(ctx)
+
+	var total int64
+	var errs []error
+	now := time.Now()
+	for _, p := range Policies(c) {
+		if !conn.Migrator().HasTable(p.Table) {
+			continue
+		}
+		// 按天分区的表由 mysql 输出删除过期分区
+		if partitioned, err := m.Partitioned(p.Table); err != nil || partitioned {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", p.Table, err))
+			}
+			continue
+		}
+		if err := prepareIndex(conn, p.Table, ip); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", p.Table, err))
+			continue
+		}
+		n, err := purge(ctx, conn, c, p.Table, ip, now.Add(-p.Keep))
+		total += n
+		if err != nil {
+			if ctx.Err() != nil {
+				return total, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s: %v", p.Table, err))
+			continue
+		}
+		if n > 0 {
+			log.Printf("retention purged %d rows from %s before %s", n, p.Table, now.Add(-p.Keep).Format(time.DateTime))
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// CreateIndexes 为缺少清理所需索引的表建索引；大表上建索引耗时较长，清理时只为空表自动建索引，
+// 已有数据的表需在低峰期用 moniter purge index 执行
+func CreateIndexes(ctx context.Context, c conf.RetentionConfig) error {
+	m := sink.FindMySQL(c.Sink)
+	if m == nil {
+		return fmt.Errorf("no mysql sink %q", c.Sink)
+	}
+	conn, err := m.DB()
+	if err != nil {
+		return err
+	}
+	conn = conn.WithContext(ctx)
+	for _, p := range Policies(c) {
+		if !conn.Migrator().HasTable(p.Table) {
+			continue
+		}
+		if partitioned, err := m.Partitioned(p.Table); err != nil || partitioned {
+			if err != nil {
+				return fmt.Errorf("%s: %v", p.Table, err)
+			}
+			continue
+		}
+		for _, index := range []string{hostIndex, timeIndex} {
+			if conn.Migrator().HasIndex(p.Table, index) {
+				continue
+			}
+			log.Printf("retention creating index %s on %s", index, p.Table)
+			if err := createIndex(conn, p.Table, index); err != nil {
+				return fmt.Errorf("%s: %v", p.Table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// prepareIndex 检查清理一张表所需的索引（按主机清理用 hostIndex，清理全部主机用 timeIndex），
+// 缺少时空表直接建索引，已有数据的表返回错误，避免全表扫描的 DELETE 锁住整张表
+func prepareIndex(conn *gorm.DB, table, ip string) error {
+	index := timeIndex
+	if ip != "" {
+		index = hostIndex
+	}
+	if conn.Migrator().HasIndex(table, index) {
+		return nil
+	}
+	var ids []uint
+	if err := conn.Table(table).Limit(1).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		return fmt.Errorf("no index %s, run `moniter purge index` to create it", index)
+	}
+	return createIndex(conn, table, index)
+}
+
+// createIndex 为表建清理所用的索引
+func createIndex(conn *gorm.DB, table, index string) error {
+	return conn.Exec(fmt.Sprintf("CREATE INDEX `%s` ON `%s` (%s)", index, table, indexColumns[index])).Error
+}
+
+// purge 分批删除一张表中 before 之前的数据，直到删完或 ctx 取消；每批按索引查出过期行的主键再按主键删除，
+// DELETE 只锁住要删除的行
+func purge(ctx context.Context, conn *gorm.DB, c conf.RetentionConfig, table, ip string, before time.Time) (int64, error) {
+	pause := time.Duration(c.ChunkPause) * time.Millisecond
+
+	var total int64
+	for {
+		query := conn.Table(table).Where("timestamp < ?", before)
+		if ip != "" {
+			query = conn.Table(table).Where("ip = ? AND timestamp < ?", ip, before)
+		}
+		var ids []uint
+		if err := query.Order("timestamp").Limit(c.ChunkSize).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := conn.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE id IN ?", table), ids)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if len(ids) < c.ChunkSize {
+			return total, nil
+		}
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package rollup 将原始数据按 1m、5m、1h 汇总为每个 ip、command 的 count/min/avg/max/p95，
+// 采集进程增量汇总本机数据，moniter rollup 命令汇总全部主机或重算指定时间段，按唯一键覆盖写入，可重复执行
+package rollup
+
+import (
+	"fmt"
+	"math"
+	"moniter/model"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCommandLen 汇总表 command 列的长度，-l 模式下的长命令行截断
+const maxCommandLen = 255
+
+// Resolution 汇总粒度
+type Resolution struct {
+	Name     string        // 粒度名称，作为汇总表名后缀
+	Duration time.Duration // 时间段长度
+}
+
+// resolutions 支持的汇总粒度
+var resolutions = []Resolution{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+}
+
+// Resolutions 按名称查找汇总粒度，names 为空时返回全部
+func Resolutions(names []string) ([]Resolution, error) {
+	if len(names) == 0 {
+		return resolutions, nil
+	}
+	res := make([]Resolution, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, r := range resolutions {
+			if r.Name == name {
+				res = append(res, r)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown rollup resolution %q", name)
+		}
+	}
+	return res, nil
+}
+
+// rollupKey 汇总行的唯一键
+type rollupKey struct {
+	ip      string
+	command string
+	field   string
+	bucket  int64 // 时间段开始时间（Unix 秒）
+}
+
+// aggregate 按粒度将原始数据汇总为每个时间段、ip、command、数值列一行，结果按唯一键排序
+func aggregate(metrics []model.Metric, d time.Duration) []model.Rollup {
+	values := make(map[rollupKey][]float64)
+	buckets := make(map[int64]time.Time)
+	for _, m := range metrics {
+		tags := m.Tags()
+		bucket := m.Time().Truncate(d)
+		buckets[bucket.Unix()] = bucket
+		vs := m.Values()
+		for i, f := range m.Fields() {
+			k := rollupKey{tags.IP, truncate(tags.Command), f.Name, bucket.Unix()}
+			values[k] = append(values[k], vs[i])
+		}
+	}
+
+	keys := make([]rollupKey, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.ip != b.ip {
+			return a.ip < b.ip
+		}
+		if a.command != b.command {
+			return a.command < b.command
+		}
+		if a.field != b.field {
+			return a.field < b.field
+		}
+		return a.bucket < b.bucket
+	})
+
+	rows := make([]model.Rollup, len(keys))
+	for i, k := range keys {
+		vs := values[k]
+		sort.Float64s(vs)
+		sum := 0.0
+		for _, v := range vs {
+			sum += v
+		}
+		rows[i] = model.Rollup{
+			IP:        k.ip,
+			Command:   k.command,
+			Field:     k.field,
+			Timestamp: buckets[k.bucket],
+			Count:     len(vs),
+			Min:       vs[0],
+			Avg:       sum / float64(len(vs)),
+			Max:       vs[len(vs)-1],
+			P95:       percentile(vs, 0.95),
+		}
+	}
+	return rows
+}
+
+// percentile 已排序数据的分位数（最近秩法）
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// truncate 截断超过汇总表列长度的命令
+func truncate(command string) string {
+	if utf8.RuneCountInString(command) <= maxCommandLen {
+		return command
+	}
+	return string([]rune(command)[:maxCommandLen])
+}
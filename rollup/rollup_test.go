@@ -0,0 +1,95 @@
+package rollup
+
+import (
+	"moniter/model"
+	"testing"
+	"time"
+)
+
+// base 一分钟时间段的开始时间
+var base = time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+// samples n 个 mysqld 的 CPU 采样，total 依次为 1..n，从 base 起每秒一个，交替使用两个 PID
+func samples(n int) []model.Metric {
+	metrics := make([]model.Metric, n)
+	for i := range metrics {
+		metrics[i] = model.ProcessCPUStats{
+			IP:        "10.0.0.1",
+			Timestamp: base.Add(time.Duration(i) * time.Second),
+			PID:       100 + i%2,
+			Command:   "mysqld",
+			Total:     float64(n - i),
+		}
+	}
+	return metrics
+}
+
+// totals 汇总结果中 total 列的行
+func totals(rows []model.Rollup) []model.Rollup {
+	var out []model.Rollup
+	for _, r := range rows {
+		if r.Field == "total" {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func TestAggregate(t *testing.T) {
+	cases := []struct {
+		name    string
+		metrics []model.Metric
+		want    []model.Rollup
+	}{
+		{
+			name:    "empty bucket",
+			metrics: nil,
+			want:    nil,
+		},
+		{
+			name:    "single sample",
+			metrics: samples(1),
+			want:    []model.Rollup{{Count: 1, Min: 1, Avg: 1, Max: 1, P95: 1}},
+		},
+		{
+			// ceil(0.95*20) = 19，取第 19 个
+			name:    "p95 n=20",
+			metrics: samples(20),
+			want:    []model.Rollup{{Count: 20, Min: 1, Avg: 10.5, Max: 20, P95: 19}},
+		},
+		{
+			// ceil(0.95*21) = 20，取第 20 个
+			name:    "p95 n=21",
+			metrics: samples(21),
+			want:    []model.Rollup{{Count: 21, Min: 1, Avg: 11, Max: 21, P95: 20}},
+		},
+		{
+			// 10:00:00-10:00:59 为同一时间段，10:01:00 起为下一个时间段
+			name:    "truncate bucket",
+			metrics: samples(61),
+			want: []model.Rollup{
+				{Count: 60, Min: 2, Avg: 31.5, Max: 61, P95: 58},
+				{Timestamp: base.Add(time.Minute), Count: 1, Min: 1, Avg: 1, Max: 1, P95: 1},
+			},
+		},
+	}
+	for _, c := range cases {
+		got := totals(aggregate(c.metrics, time.Minute))
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: got %d rows, want %d: %+v", c.name, len(got), len(c.want), got)
+		}
+		for i, want := range c.want {
+			want.IP, want.Command, want.Field = "10.0.0.1", "mysqld", "total"
+			if want.Timestamp.IsZero() {
+				want.Timestamp = base
+			}
+			if !got[i].Timestamp.Equal(want.Timestamp) {
+				t.Errorf("%s: row %d timestamp %v, want %v", c.name, i, got[i].Timestamp, want.Timestamp)
+			}
+			got[i].Timestamp = want.Timestamp
+			if got[i] != want {
+				t.Errorf("%s: row %d = %+v, want %+v", c.name, i, got[i], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"moniter/async"
+	"moniter/conf"
+	"moniter/model"
+	"moniter/sink"
+	"sync"
+	"time"
+)
+
+// window 每次读取的原始数据时间跨度，为全部粒度的整数倍
+const window = time.Hour
+
+var (
+	// running 增量汇总的 goroutine
+	running sync.WaitGroup
+
+	migrateMu sync.Mutex
+	migrated  bool
+
+	statusMu sync.Mutex
+	status   Status
+)
+
+// Status 增量汇总的运行状态
+type Status struct {
+	Enabled   bool      `json:"enabled"`    // 是否启用增量汇总
+	LastRun   time.Time `json:"last_run"`   // 最近一次汇总结束时间
+	Rows      int       `json:"rows"`       // 最近一次写入的汇总行数
+	LastError string    `json:"last_error"` // 最近一次汇总的错误，成功时为空
+}
+
+// CurrentStatus 增量汇总当前的运行状态
+func CurrentStatus() Status {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return status
+}
+
+// setStatus 记录一次增量汇总的结果
+func setStatus(rows int, err error) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status.LastRun = time.Now()
+	status.Rows = rows
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	}
+}
+
+// Start 按配置每 interval 秒增量汇总一次本机（conf.Sc.IP）的数据，ctx 取消后停止；
+// 没有 mysql 输出时不汇总
+func Start(ctx context.Context, c conf.RollupConfig) error {
+	if c.Interval <= 0 {
+		return nil
+	}
+	if _, err := Resolutions(c.Resolutions); err != nil {
+		return err
+	}
+	if sink.FindMySQL(c.Sink) == nil {
+		if c.Sink != "" {
+			return fmt.Errorf("rollup sink %q is not a mysql sink", c.Sink)
+		}
+		log.Printf("rollup disabled: no mysql sink")
+		return nil
+	}
+
+	statusMu.Lock()
+	status.Enabled = true
+	statusMu.Unlock()
+
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		ticker := time.NewTicker(time.Duration(c.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := Catchup(ctx, c, []string{conf.Sc.IP})
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.Printf("rollup Catchup ,err : %v", err)
+				}
+				setStatus(n, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Wait 等待增量汇总退出（需先取消 Start 时传入的 ctx），关闭输出前调用；ctx 到期后返回 ctx 的错误
+func Wait(ctx context.Context) error {
+	return async.WaitGroup(ctx, &running)
+}
+
+// Catchup 从上次的进度汇总到 delay 秒之前，ips 为 nil 时汇总全部主机，返回写入的汇总行数；
+// 从未汇总过的主机从最早的原始数据开始
+func Catchup(ctx context.Context, c conf.RollupConfig, ips []string) (int, error) {
+	conn, res, err := open(c)
+	if err != nil {
+		return 0, err
+	}
+	// 全部查询随 ctx 取消，关机时不等待慢查询
+	conn = conn.WithContext(ctx)
+	until := time.Now().Add(-time.Duration(c.Delay) * time.Second)
+
+	total := 0
+	var errs []error
+	for _, src := range sources {
+		hosts := ips
+		if hosts == nil {
+			if hosts, err = src.ips(conn); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", src.Table(), err))
+				continue
+			}
+		}
+		for _, ip := range hosts {
+			n, err := catchup(ctx, conn, src, res, ip, until)
+			total += n
+			if err != nil {
+				if ctx.Err() != nil {
+					return total, ctx.Err()
+				}
+				errs = append(errs, fmt.Errorf("%s %s: %v", src.Table(), ip, err))
+			}
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// Recompute 重算 [from, to) 内全部主机的汇总，不改变增量汇总的进度，返回写入的汇总行数
+func Recompute(ctx context.Context, c conf.RollupConfig, from, to time.Time) (int, error) {
+	conn, res, err := open(c)
+	if err != nil {
+		return 0, err
+	}
+	// 全部查询随 ctx 取消，关机时不等待慢查询
+	conn = conn.WithContext(ctx)
+
+	// 起止按各粒度对齐，覆盖 [from, to) 所在的全部时间段
+	spans := make([]span, len(res))
+	for i, r := range res {
+		end := to.Truncate(r.Duration)
+		if end.Before(to) {
+			end = end.Add(r.Duration)
+		}
+		spans[i] = span{res: r, from: from.Truncate(r.Duration), to: end}
+	}
+
+	total := 0
+	for _, src := range sources {
+		ips, err := src.ips(conn)
+		if err != nil {
+			return total, fmt.Errorf("%s: %v", src.Table(), err)
+		}
+		for _, ip := range ips {
+			n, err := rollupSpans(ctx, conn, src, ip, spans)
+			total += n
+			if err != nil {
+				return total, fmt.Errorf("%s %s: %v", src.Table(), ip, err)
+			}
+		}
+	}
+	return total, nil
+}
+
+// open 连接配置的 mysql 输出并建表；原始表缺少 rawIndex 且已有数据时返回错误，不做全表扫描的汇总
+func open(c conf.RollupConfig) (*gorm.DB, []Resolution, error) {
+	res, err := Resolutions(c.Resolutions)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := sink.FindMySQL(c.Sink)
+	if m == nil {
+		return nil, nil, fmt.Errorf("no mysql sink %q", c.Sink)
+	}
+	conn, err := m.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrateMu.Lock()
+	defer migrateMu.Unlock()
+	if !migrated {
+		if err := migrate(conn, resolutions); err != nil {
+			return nil, nil, err
+		}
+		migrated = true
+	}
+	// 每次都检查，原始表可能在启动后才由输出创建
+	if err := prepareIndexes(conn); err != nil {
+		return nil, nil, err
+	}
+	return conn, res, nil
+}
+
+// CreateIndexes 为缺少 (ip, timestamp) 索引的原始表建索引，按时间段汇总与按主机清理都依赖该索引；
+// 大表上建索引耗时较长，汇总时只为空表自动建索引，已有数据的表需在低峰期用 moniter rollup index 执行
+func CreateIndexes(ctx context.Context, c conf.RollupConfig) error {
+	m := sink.FindMySQL(c.Sink)
+	if m == nil {
+		return fmt.Errorf("no mysql sink %q", c.Sink)
+	}
+	conn, err := m.DB()
+	if err != nil {
+		return err
+	}
+	conn = conn.WithContext(ctx)
+	for _, table := range missingIndexes(conn) {
+		log.Printf("rollup creating index %s on %s", rawIndex, table)
+		if err := createIndex(conn, table); err != nil {
+			return fmt.Errorf("%s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// span 一个粒度待汇总的时间段，起止按粒度对齐
+type span struct {
+	res      Resolution
+	from, to time.Time
+	progress func(to time.Time) error // 每段写完后保存进度，为 nil 时不保存
+}
+
+// catchup 从一个主机各粒度的进度汇总到 until 所在时间段之前
+func catchup(ctx context.Context, conn *gorm.DB, src source, res []Resolution, ip string, until time.Time) (int, error) {
+	var oldest time.Time
+	spans := make([]span, 0, len(res))
+	for _, r := range res {
+		r := r
+		done, err := loadState(conn, ip, src.Kind(), r.Name)
+		if err != nil {
+			return 0, err
+		}
+		if done.IsZero() {
+			if oldest.IsZero() {
+				if oldest, err = src.oldest(conn, ip); err != nil {
+					return 0, err
+				}
+				if oldest.IsZero() {
+					return 0, nil
+				}
+			}
+			done = oldest.Truncate(r.Duration)
+		}
+		spans = append(spans, span{res: r, from: done, to: until.Truncate(r.Duration), progress: func(to time.Time) error {
+			return saveState(conn, ip, src.Kind(), r.Name, to)
+		}})
+	}
+	return rollupSpans(ctx, conn, src, ip, spans)
+}
+
+// rollupSpans 按 window 分段读取一个主机在各 span 覆盖范围内的原始数据，每段只读取一次，
+// 汇总为各 span 的粒度后写入，每段写完后调用 span 的 progress 保存进度
+func rollupSpans(ctx context.Context, conn *gorm.DB, src source, ip string, spans []span) (int, error) {
+	var from, to time.Time
+	for _, s := range spans {
+		if !s.from.Before(s.to) {
+			continue
+		}
+		if from.IsZero() || s.from.Before(from) {
+			from = s.from
+		}
+		if s.to.After(to) {
+			to = s.to
+		}
+	}
+
+	total := 0
+	for from.Before(to) {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		end := from.Truncate(window).Add(window)
+		if end.After(to) {
+			end = to
+		}
+		metrics, err := src.load(conn, ip, from, end)
+		if err != nil {
+			return total, err
+		}
+		for _, s := range spans {
+			lo, hi := s.from, s.to
+			if lo.Before(from) {
+				lo = from
+			}
+			if hi.After(end) {
+				hi = end
+			}
+			if !lo.Before(hi) {
+				continue
+			}
+			rows := aggregate(within(metrics, lo, hi), s.res.Duration)
+			if err := upsert(conn, rollupTable(src, s.res), rows); err != nil {
+				return total, err
+			}
+			total += len(rows)
+			if s.progress != nil {
+				if err := s.progress(hi); err != nil {
+					return total, err
+				}
+			}
+		}
+		from = end
+	}
+	return total, nil
+}
+
+// within [from, to) 内的数据
+func within(metrics []model.Metric, from, to time.Time) []model.Metric {
+	in := make([]model.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if t := m.Time(); !t.Before(from) && t.Before(to) {
+			in = append(in, m)
+		}
+	}
+	return in
+}
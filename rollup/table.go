@@ -0,0 +1,177 @@
+package rollup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"moniter/model"
+	"time"
+)
+
+const (
+	// batchSize 每条 INSERT 的最大行数
+	batchSize = 1000
+	// rawIndex 原始表按 ip 与时间段读取所用的索引
+	rawIndex = "idx_ip_timestamp"
+)
+
+// source 一张原始数据表
+type source interface {
+	// Kind 数据类型：cpu、memory、io
+	Kind() string
+	// Table 原始表名
+	Table() string
+	// load 读取一个 ip 在 [from, to) 内的原始数据
+	load(conn *gorm.DB, ip string, from, to time.Time) ([]model.Metric, error)
+	// oldest 一个 ip 最早的采样时间，没有数据时返回零值
+	oldest(conn *gorm.DB, ip string) (time.Time, error)
+	// ips 表中全部 ip
+	ips(conn *gorm.DB) ([]string, error)
+}
+
+// table 按数据结构读取原始表
+type table[T model.Metric] struct {
+	kind string
+	name string
+}
+
+// sources 参与汇总的原始表
+var sources = []source{
+	table[model.ProcessCPUStats]{model.KindCPU, "process_cpu_stats"},
+	table[model.ProcessMemStats]{model.KindMemory, "process_mem_stats"},
+	table[model.ProcessIOStats]{model.KindIO, "process_io_stats"},
+}
+
+func (t table[T]) Kind() string  { return t.kind }
+func (t table[T]) Table() string { return t.name }
+
+func (t table[T]) load(conn *gorm.DB, ip string, from, to time.Time) ([]model.Metric, error) {
+	var rows []T
+	err := conn.Where("ip = ? AND timestamp >= ? AND timestamp < ?", ip, from, to).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]model.Metric, len(rows))
+	for i := range rows {
+		metrics[i] = rows[i]
+	}
+	return metrics, nil
+}
+
+func (t table[T]) oldest(conn *gorm.DB, ip string) (time.Time, error) {
+	var ts sql.NullTime
+	err := conn.Model(new(T)).Where("ip = ?", ip).Select("MIN(timestamp)").Scan(&ts).Error
+	return ts.Time, err
+}
+
+func (t table[T]) ips(conn *gorm.DB) ([]string, error) {
+	var ips []string
+	err := conn.Model(new(T)).Distinct("ip").Pluck("ip", &ips).Error
+	return ips, err
+}
+
+// Table 一张原始表或汇总表
+type Table struct {
+	Name       string // 表名
+	Resolution string // raw 或汇总粒度名称
+}
+
+// Tables 参与汇总的原始表与全部粒度的汇总表
+func Tables() []Table {
+	tables := make([]Table, 0, len(sources)*(len(resolutions)+1))
+	for _, src := range sources {
+		tables = append(tables, Table{src.Table(), "raw"})
+		for _, r := range resolutions {
+			tables = append(tables, Table{rollupTable(src, r), r.Name})
+		}
+	}
+	return tables
+}
+
+// rollupTable 汇总表名，如 process_cpu_stats_1m
+func rollupTable(src source, res Resolution) string {
+	return src.Table() + "_" + res.Name
+}
+
+// migrate 创建进度表与全部汇总表
+func migrate(conn *gorm.DB, res []Resolution) error {
+	if err := conn.AutoMigrate(&model.RollupState{}); err != nil {
+		return err
+	}
+	for _, src := range sources {
+		for _, r := range res {
+			if err := conn.Table(rollupTable(src, r)).AutoMigrate(&model.Rollup{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// missingIndexes 已存在但缺少 rawIndex 的原始表
+func missingIndexes(conn *gorm.DB) []string {
+	tables := make([]string, 0)
+	for _, src := range sources {
+		m := conn.Migrator()
+		if m.HasTable(src.Table()) && !m.HasIndex(src.Table(), rawIndex) {
+			tables = append(tables, src.Table())
+		}
+	}
+	return tables
+}
+
+// prepareIndexes 为缺少 rawIndex 的空原始表直接建索引；已有数据的表缺少索引时返回错误，
+// 需在低峰期用 moniter rollup index 建索引后才能按时间段汇总
+func prepareIndexes(conn *gorm.DB) error {
+	var errs []error
+	for _, table := range missingIndexes(conn) {
+		var ids []uint
+		if err := conn.Table(table).Limit(1).Pluck("id", &ids).Error; err != nil {
+			return fmt.Errorf("%s: %v", table, err)
+		}
+		if len(ids) > 0 {
+			errs = append(errs, fmt.Errorf("raw table %s has no index %s, run `moniter rollup index` to create it", table, rawIndex))
+			continue
+		}
+		if err := createIndex(conn, table); err != nil {
+			return fmt.Errorf("%s: %v", table, err)
+		}
+		log.Printf("rollup created index %s on %s", rawIndex, table)
+	}
+	return errors.Join(errs...)
+}
+
+// createIndex 为原始表建 rawIndex
+func createIndex(conn *gorm.DB, table string) error {
+	return conn.Exec(fmt.Sprintf("CREATE INDEX `%s` ON `%s` (`ip`, `timestamp`)", rawIndex, table)).Error
+}
+
+// upsert 写入汇总行，唯一键已存在时覆盖，重算同一时间段结果不变
+func upsert(conn *gorm.DB, name string, rows []model.Rollup) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return conn.Table(name).Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"count", "min", "avg", "max", "p95"}),
+	}).CreateInBatches(&rows, batchSize).Error
+}
+
+// loadState 读取增量汇总进度，从未汇总时返回零值
+func loadState(conn *gorm.DB, ip, kind, res string) (time.Time, error) {
+	var states []model.RollupState
+	err := conn.Where("ip = ? AND kind = ? AND resolution = ?", ip, kind, res).Limit(1).Find(&states).Error
+	if err != nil || len(states) == 0 {
+		return time.Time{}, err
+	}
+	return states[0].Done, nil
+}
+
+// saveState 保存增量汇总进度
+func saveState(conn *gorm.DB, ip, kind, res string, done time.Time) error {
+	return conn.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"done"}),
+	}).Create(&model.RollupState{IP: ip, Kind: kind, Resolution: res, Done: done}).Error
+}
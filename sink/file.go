@@ -0,0 +1,282 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"moniter/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// FormatJSONL 每行一个 JSON 对象
+	FormatJSONL = "jsonl"
+	// FormatCSV 首行为列名的 CSV
+	FormatCSV = "csv"
+)
+
+// fileOptions file 输出的配置项
+type fileOptions struct {
+	Dir      string `json:"dir"`       // 输出目录
+	Format   string `json:"format"`    // jsonl（默认）或 csv
+	MaxSize  int    `json:"max_size"`  // 单个文件的最大大小（MB），默认 100
+	MaxFiles int    `json:"max_files"` // 每类数据最多保留的文件数（含正在写的文件），默认 48
+	Compress *bool  `json:"compress"`  // 是否 gzip 压缩轮转后的文件，默认 true
+}
+
+func init() {
+	Register("file", func(name string, options json.RawMessage) (Sink, error) {
+		opts := fileOptions{Format: FormatJSONL, MaxSize: 100, MaxFiles: 48}
+		if err := decodeOptions(options, &opts); err != nil {
+			return nil, err
+		}
+		if opts.Dir == "" {
+			return nil, fmt.Errorf("file dir is required")
+		}
+		if opts.Format != FormatJSONL && opts.Format != FormatCSV {
+			return nil, fmt.Errorf("unknown file format %q", opts.Format)
+		}
+		if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+			return nil, err
+		}
+		return &File{
+			name:     name,
+			dir:      opts.Dir,
+			format:   opts.Format,
+			maxSize:  int64(opts.MaxSize) << 20,
+			maxFiles: opts.MaxFiles,
+			compress: opts.Compress == nil || *opts.Compress,
+			files:    make(map[string]*rotatingFile),
+		}, nil
+	})
+}
+
+// File 将每批数据追加到本地文件，每类数据一组文件，按小时和大小轮转：
+//
+//	<dir>/cpu-2024010215-000.jsonl     正在写的文件
+//	<dir>/cpu-2024010214-000.jsonl.gz  轮转后压缩的文件
+//
+// 文件可以通过 moniter import 导入到其他输出
+type File struct {
+	name     string
+	dir      string
+	format   string
+	maxSize  int64
+	maxFiles int
+	compress bool
+
+	mu    sync.Mutex
+	files map[string]*rotatingFile // 数据类型 -> 正在写的文件
+}
+
+// rotatingFile 正在写的文件
+type rotatingFile struct {
+	file *os.File
+	hour string // 文件所属的小时，格式同文件名
+	size int64
+}
+
+// Name 输出名称
+func (s *File) Name() string {
+	return s.name
+}
+
+// Write 编码后整批追加到对应类型的文件，超过大小或跨小时则先轮转
+func (s *File) Write(rows interface{}) error {
+	metrics, err := model.Metrics(rows)
+	if err != nil || len(metrics) == 0 {
+		return err
+	}
+	kind := metrics[0].Kind()
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		if err := encodeRow(&buf, s.format, m); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.files[kind]
+	hour := time.Now().Format("2006010215")
+	if f == nil || f.hour != hour || (f.size > 0 && f.size+int64(buf.Len()) > s.maxSize) {
+		if f, err = s.rotate(kind, hour); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(buf.Bytes())
+	f.size += int64(n)
+	return err
+}
+
+// Close 关闭正在写的文件
+func (s *File) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for kind, f := range s.files {
+		if cerr := f.file.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(s.files, kind)
+	}
+	return err
+}
+
+// encodeRow 编码一行数据，列为 timestamp、ip、pid、user、command 以及该类型的数值列
+func encodeRow(buf *bytes.Buffer, format string, m model.Metric) error {
+	tags := m.Tags()
+	values := m.Values()
+	if format == FormatCSV {
+		record := []string{m.Time().Format(time.RFC3339Nano), tags.IP, strconv.Itoa(tags.PID), tags.User, tags.Command}
+		for _, v := range values {
+			record = append(record, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		w := csv.NewWriter(buf)
+		w.Write(record)
+		w.Flush()
+		return w.Error()
+	}
+
+	fields := m.Fields()
+	buf.WriteByte('{')
+	for i, kv := range []struct {
+		key   string
+		value interface{}
+	}{
+		{"timestamp", m.Time()},
+		{"ip", tags.IP},
+		{"pid", tags.PID},
+		{"user", tags.User},
+		{"command", tags.Command},
+	} {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := json.Marshal(kv.value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "%q:%s", kv.key, b)
+	}
+	for i, field := range fields {
+		fmt.Fprintf(buf, ",%q:%s", field.Name, strconv.FormatFloat(values[i], 'f', -1, 64))
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+// rotate 关闭当前文件并新建 hour 对应的文件，之后压缩旧文件、删除超出数量的文件
+func (s *File) rotate(kind, hour string) (*rotatingFile, error) {
+	if old := s.files[kind]; old != nil {
+		old.file.Close()
+		delete(s.files, kind)
+	}
+
+	// 序号接在同一小时已有文件之后，保证按文件名排序即按时间排序
+	seq := 0
+	existing, _ := filepath.Glob(filepath.Join(s.dir, fmt.Sprintf("%s-%s-*.%s*", kind, hour, s.format)))
+	for _, p := range existing {
+		var n int
+		if _, err := fmt.Sscanf(filepath.Base(p), kind+"-"+hour+"-%d.", &n); err == nil && n >= seq {
+			seq = n + 1
+		}
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%s-%s-%03d.%s", kind, hour, seq, s.format))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{file: file, hour: hour}
+	if s.format == FormatCSV {
+		header := []string{"timestamp", "ip", "pid", "user", "command"}
+		for _, field := range model.KindFields(kind) {
+			header = append(header, field.Name)
+		}
+		w := csv.NewWriter(file)
+		w.Write(header)
+		w.Flush()
+		if err := w.Error(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	s.files[kind] = f
+
+	// 旧文件包括上次运行留下的未压缩文件
+	if s.compress {
+		s.compressOld(kind, path)
+	}
+	s.purge(kind)
+	return f, nil
+}
+
+// compressOld 压缩除 active 外所有未压缩的文件
+func (s *File) compressOld(kind, active string) {
+	paths, _ := filepath.Glob(filepath.Join(s.dir, kind+"-*."+s.format))
+	for _, path := range paths {
+		if path == active {
+			continue
+		}
+		if err := gzipFile(path); err != nil {
+			log.Printf("sink %s compress %s ,err : %v", s.name, path, err)
+		}
+	}
+}
+
+// purge 按文件名（即时间）排序，删除最旧的文件直到不超过 maxFiles 个
+func (s *File) purge(kind string) {
+	if s.maxFiles <= 0 {
+		return
+	}
+	plain, _ := filepath.Glob(filepath.Join(s.dir, kind+"-*."+s.format))
+	compressed, _ := filepath.Glob(filepath.Join(s.dir, kind+"-*."+s.format+".gz"))
+	paths := append(plain, compressed...)
+	sort.Strings(paths)
+	for len(paths) > s.maxFiles {
+		if err := os.Remove(paths[0]); err != nil {
+			log.Printf("sink %s remove %s ,err : %v", s.name, paths[0], err)
+		}
+		paths = paths[1:]
+	}
+}
+
+// gzipFile 压缩为 path.gz 后删除原文件
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,155 @@
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"moniter/model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// dataFileName file 输出的文件名：数据类型-小时-序号.格式[.gz]
+var dataFileName = regexp.MustCompile(`^(cpu|memory|io|task)-.*\.(jsonl|csv)(\.gz)?$`)
+
+// IsDataFile 是否为 file 输出写出的文件
+func IsDataFile(path string) bool {
+	return dataFileName.MatchString(filepath.Base(path))
+}
+
+// ReadFile 读取 file 输出写出的文件，数据类型与格式由文件名决定，每行数据回调一次
+func ReadFile(path string, handle func(m model.Metric) error) error {
+	match := dataFileName.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return fmt.Errorf("%s is not a sink data file", path)
+	}
+	kind, format, compressed := match[1], match[2], match[3] != ""
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if compressed {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if format == FormatCSV {
+		return readCSV(r, kind, handle)
+	}
+	return readJSONL(r, kind, handle)
+}
+
+// readJSONL 逐行解析 JSON 对象，缺少的数值列按 0 处理
+func readJSONL(r io.Reader, kind string, handle func(m model.Metric) error) error {
+	fields := model.KindFields(kind)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var row struct {
+			Timestamp time.Time `json:"timestamp"`
+			IP        string    `json:"ip"`
+			PID       int       `json:"pid"`
+			User      string    `json:"user"`
+			Command   string    `json:"command"`
+		}
+		var columns map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &columns); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		values := make([]float64, len(fields))
+		for i, field := range fields {
+			if raw, ok := columns[field.Name]; ok {
+				if err := json.Unmarshal(raw, &values[i]); err != nil {
+					return fmt.Errorf("line %d column %s: %v", line, field.Name, err)
+				}
+			}
+		}
+		m, err := model.NewMetric(kind, model.Tags{IP: row.IP, PID: row.PID, User: row.User, Command: row.Command}, row.Timestamp, values)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := handle(m); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readCSV 按首行列名解析，缺少的数值列按 0 处理
+func readCSV(r io.Reader, kind string, handle func(m model.Metric) error) error {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[name] = i
+	}
+	for _, name := range []string{"timestamp", "ip", "pid", "user", "command"} {
+		if _, ok := index[name]; !ok {
+			return fmt.Errorf("missing column %s", name)
+		}
+	}
+	reader.FieldsPerRecord = len(header)
+
+	fields := model.KindFields(kind)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		ts, err := time.Parse(time.RFC3339Nano, record[index["timestamp"]])
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		pid, err := strconv.Atoi(record[index["pid"]])
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		values := make([]float64, len(fields))
+		for i, field := range fields {
+			col, ok := index[field.Name]
+			if !ok {
+				continue
+			}
+			if values[i], err = strconv.ParseFloat(record[col], 64); err != nil {
+				return fmt.Errorf("line %d column %s: %v", line, field.Name, err)
+			}
+		}
+		tags := model.Tags{IP: record[index["ip"]], PID: pid, User: record[index["user"]], Command: record[index["command"]]}
+		m, err := model.NewMetric(kind, tags, ts, values)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := handle(m); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"moniter/model"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// influxDBOptions influxdb 输出的配置项，url 与 file 二选一
+type influxDBOptions struct {
+	URL     string `json:"url"`     // InfluxDB v2 地址，如 http://influxdb:8086，写入 /api/v2/write
+	Org     string `json:"org"`     // 组织
+	Bucket  string `json:"bucket"`  // bucket
+	Token   string `json:"token"`   // API token
+	Timeout int    `json:"timeout"` // 单次请求超时（秒），默认 10
+	File    string `json:"file"`    // 追加写入的本地文件
+}
+
+func init() {
+	Register("influxdb", func(name string, options json.RawMessage) (Sink, error) {
+		opts := influxDBOptions{Timeout: 10}
+		if err := decodeOptions(options, &opts); err != nil {
+			return nil, err
+		}
+		s := &InfluxDB{name: name}
+		switch {
+		case opts.URL != "" && opts.File != "":
+			return nil, fmt.Errorf("influxdb url and file are mutually exclusive")
+		case opts.URL != "":
+			query := url.Values{"org": {opts.Org}, "bucket": {opts.Bucket}, "precision": {"ns"}}
+			s.url = strings.TrimRight(opts.URL, "/") + "/api/v2/write?" + query.Encode()
+			s.token = opts.Token
+			s.client = &http.Client{Timeout: time.Duration(opts.Timeout) * time.Second}
+		case opts.File != "":
+			file, err := os.OpenFile(opts.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				return nil, err
+			}
+			s.file = file
+		default:
+			return nil, fmt.Errorf("influxdb url or file is required")
+		}
+		return s, nil
+	})
+}
+
+// InfluxDB 将每行数据转为 InfluxDB 行协议，写入 InfluxDB v2 或追加到本地文件
+//
+//	cpu,command=mysqld,ip=10.0.0.1,pid=1234,user=mysql usr=1.5,system=0.5,... 1700000000000000000
+type InfluxDB struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Name 输出名称
+func (s *InfluxDB) Name() string {
+	return s.name
+}
+
+// Write 一批数据转为一次请求或一次文件追加
+func (s *InfluxDB) Write(rows interface{}) error {
+	metrics, err := model.Metrics(rows)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		appendLineProtocol(&buf, m)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	if s.file != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, err := s.file.Write(buf.Bytes())
+		return err
+	}
+	return s.post(buf.Bytes())
+}
+
+// Close 关闭文件或空闲连接
+func (s *InfluxDB) Close() error {
+	if s.file != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.file.Close()
+	}
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// post 写入 /api/v2/write
+func (s *InfluxDB) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influxdb write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// influxTagEscaper 转义 measurement、tag 键值中的逗号、等号与空格
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+// appendLineProtocol 追加一行行协议，measurement 为数据类型，tag 为 ip、pid、user、command（空值省略），时间戳为纳秒
+func appendLineProtocol(buf *bytes.Buffer, m model.Metric) {
+	tags := m.Tags()
+	buf.WriteString(m.Kind())
+	for _, tag := range tags.Pairs() {
+		buf.WriteByte(',')
+		buf.WriteString(tag[0])
+		buf.WriteByte('=')
+		buf.WriteString(influxTagEscaper.Replace(tag[1]))
+	}
+
+	values := m.Values()
+	for i, field := range m.Fields() {
+		if i == 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(field.Name)
+		buf.WriteByte('=')
+		buf.WriteString(strconv.FormatFloat(values[i], 'f', -1, 64))
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(m.Time().UnixNano(), 10))
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,236 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"moniter/conf"
+	"moniter/db"
+	"moniter/model"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// mysqlOptions mysql 输出的配置项
+type mysqlOptions struct {
+	conf.DBConfig
+	BatchSize      int  `json:"batch_size"`      // 每条 INSERT 的最大行数，默认 1000
+	Partition      bool `json:"partition"`       // process_*_stats 表按天分区，按 retention 配置删除过期分区
+	PartitionAhead int  `json:"partition_ahead"` // 预建今天之后的分区天数，默认 7
+}
+
+func init() {
+	Register("mysql", func(name string, options json.RawMessage) (Sink, error) {
+		opts := mysqlOptions{BatchSize: 1000, PartitionAhead: 7}
+		if err := decodeOptions(options, &opts); err != nil {
+			return nil, err
+		}
+		s := NewMySQL(name, opts.DBConfig, opts.BatchSize)
+		if opts.Partition {
+			s.partitionByDay(opts.PartitionAhead)
+		}
+		return s, nil
+	})
+}
+
+// MySQL 通过 GORM 写入 MySQL，启动时连不上数据库不会失败，每次写入时重试连接
+type MySQL struct {
+	name      string
+	config    conf.DBConfig
+	batchSize int
+
+	partition bool // process_*_stats 表是否按天分区
+	ahead     int  // 预建今天之后的分区天数
+
+	mu   sync.Mutex
+	conn *gorm.DB
+
+	stop chan struct{} // 停止分区维护
+	done chan struct{}
+}
+
+// NewMySQL 创建 mysql 输出并尝试连接、建表
+func NewMySQL(name string, config conf.DBConfig, batchSize int) *MySQL {
+	s := &MySQL{
+		name:      name,
+		config:    config,
+		batchSize: batchSize,
+	}
+	if _, err := s.DB(); err != nil {
+		log.Printf("sink %s connect ,err : %v", name, err)
+	}
+	return s
+}
+
+// Name 输出名称
+func (s *MySQL) Name() string {
+	return s.name
+}
+
+// DB 返回数据库连接，未连接时连接并建表
+func (s *MySQL) DB() (*gorm.DB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		return s.conn, nil
+	}
+	conn, err := db.Open(s.config)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.AutoMigrate(model.Tables()...); err != nil {
+		db.Close(conn)
+		return nil, err
+	}
+	if s.partition {
+		if err := preparePartitions(conn, s.ahead); err != nil && !errors.Is(err, errPartitionLocked) {
+			log.Printf("sink %s partition ,err : %v", s.name, err)
+		}
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+// partitionByDay 启用按天分区，已连接时立即建分区，之后每小时预建分区、删除过期分区
+func (s *MySQL) partitionByDay(ahead int) {
+	s.mu.Lock()
+	s.partition = true
+	s.ahead = ahead
+	conn := s.conn
+	s.mu.Unlock()
+	if conn != nil {
+		if err := preparePartitions(conn, ahead); err != nil && !errors.Is(err, errPartitionLocked) {
+			log.Printf("sink %s partition ,err : %v", s.name, err)
+		}
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(partitionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if err := s.maintainPartitions(); err != nil && !errors.Is(err, errPartitionLocked) {
+					log.Printf("sink %s partition ,err : %v", s.name, err)
+				}
+			}
+		}
+	}()
+}
+
+// maintainPartitions 预建分区、删除过期分区
+func (s *MySQL) maintainPartitions() error {
+	conn, err := s.DB()
+	if err != nil {
+		return err
+	}
+	return withPartitionLock(conn, func(tx *gorm.DB) error {
+		for _, table := range partitionTables {
+			if err := maintainPartitions(tx, table, s.ahead, keepDays(table), time.Now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Partitioned 表是否已按天分区且由本输出删除过期分区，此时不需要逐行清理
+func (s *MySQL) Partitioned(table string) (bool, error) {
+	if !s.partition {
+		return false, nil
+	}
+	conn, err := s.DB()
+	if err != nil {
+		return false, err
+	}
+	_, partitioned, err := partitions(conn, table)
+	return partitioned, err
+}
+
+// MigratePartitions 将已有数据的未分区 process_*_stats 表迁移为按天分区，未启用分区时不做任何事
+func (s *MySQL) MigratePartitions() error {
+	if !s.partition {
+		return nil
+	}
+	conn, err := s.DB()
+	if err != nil {
+		return err
+	}
+	return migratePartitions(conn, s.ahead)
+}
+
+// Write 批量插入
+func (s *MySQL) Write(rows interface{}) error {
+	conn, err := s.DB()
+	if err != nil {
+		return err
+	}
+	return conn.CreateInBatches(withoutIDs(rows), s.batchSize).Error
+}
+
+// withoutIDs 复制一批数据并清空 ID，由数据库分配自增 ID；
+// 同一批数据会交给多个输出，GORM 回写的 ID 不能写进原数据
+func withoutIDs(rows interface{}) interface{} {
+	c := copyRows(rows)
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Slice {
+		return rows
+	}
+	for i := 0; i < v.Len(); i++ {
+		if id := v.Index(i).FieldByName("ID"); id.IsValid() && id.CanSet() {
+			id.SetZero()
+		}
+	}
+	return c
+}
+
+// Close 停止分区维护并关闭数据库连接池
+func (s *MySQL) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := db.Close(s.conn)
+	s.conn = nil
+	return err
+}
+
+// FindMySQL 按名称查找已创建的 mysql 输出（含磁盘暂存包装的），name 为空时返回第一个，找不到返回 nil
+func FindMySQL(name string) *MySQL {
+	for _, s := range All() {
+		if sp, ok := s.(*Spool); ok {
+			s = sp.Sink
+		}
+		if m, ok := s.(*MySQL); ok && (name == "" || m.Name() == name) {
+			return m
+		}
+	}
+	return nil
+}
+
+// MigratePartitions 迁移全部启用了按天分区的 mysql 输出的未分区表
+func MigratePartitions() error {
+	var errs []error
+	for _, s := range All() {
+		if sp, ok := s.(*Spool); ok {
+			s = sp.Sink
+		}
+		if m, ok := s.(*MySQL); ok {
+			if err := m.MigratePartitions(); err != nil {
+				errs = append(errs, fmt.Errorf("sink %s: %v", m.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,273 @@
+package sink
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"moniter/conf"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// partitionMax 兜底分区，接收超出最后一个按天分区的数据，新增分区时从中拆分
+	partitionMax = "pmax"
+	// partitionLock 多个采集进程共用一个数据库时，同一时间只有一个维护分区
+	partitionLock = "moniter_partition"
+	// partitionInterval 检查、新增、删除分区的间隔
+	partitionInterval = time.Hour
+	// autoIncrementGap 迁移时新表的自增起点高于旧表最大 ID 的余量，切换期间写入旧表的数据补写时 ID 不冲突
+	autoIncrementGap = 10000000
+	// backfillChunk 迁移时每条 INSERT ... SELECT 覆盖的 ID 范围
+	backfillChunk = 10000
+)
+
+// errPartitionLocked 其他进程正在维护分区，定期维护时忽略，下次再试
+var errPartitionLocked = errors.New("partition maintenance held by another process")
+
+// partitionTables 按天分区的原始数据表
+var partitionTables = []string{"process_cpu_stats", "process_mem_stats", "process_io_stats"}
+
+// day 当天零点
+func day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// partitionName 某一天的分区名，如 p20240102
+func partitionName(d time.Time) string {
+	return "p" + d.Format("20060102")
+}
+
+// partitionDefs [from, to] 内每天一个分区的定义
+func partitionDefs(from, to time.Time) []string {
+	defs := make([]string, 0)
+	for d := day(from); !d.After(to); d = d.AddDate(0, 0, 1) {
+		defs = append(defs, fmt.Sprintf("PARTITION %s VALUES LESS THAN (TO_DAYS('%s'))",
+			partitionName(d), d.AddDate(0, 0, 1).Format(time.DateOnly)))
+	}
+	return append(defs, fmt.Sprintf("PARTITION %s VALUES LESS THAN MAXVALUE", partitionMax))
+}
+
+// partitionClause 按天分区的建表子句，[from, to] 内每天一个分区
+func partitionClause(from, to time.Time) string {
+	return fmt.Sprintf("PARTITION BY RANGE (TO_DAYS(`timestamp`)) (%s)", strings.Join(partitionDefs(from, to), ", "))
+}
+
+// partitionKeyClause 分区表的主键需包含分区列
+const partitionKeyClause = "MODIFY `timestamp` datetime NOT NULL, DROP PRIMARY KEY, ADD PRIMARY KEY (`id`, `timestamp`)"
+
+// partitions 表的按天分区（不含 pmax）的日期，按日期排序，以及表是否已分区
+func partitions(conn *gorm.DB, table string) ([]time.Time, bool, error) {
+	var names []string
+	err := conn.Raw("SELECT PARTITION_NAME FROM information_schema.PARTITIONS "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL", table).
+		Scan(&names).Error
+	if err != nil {
+		return nil, false, err
+	}
+	days := make([]time.Time, 0, len(names))
+	for _, name := range names {
+		if d, err := time.ParseInLocation("p20060102", name, time.Local); err == nil {
+			days = append(days, d)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, len(names) > 0, nil
+}
+
+// keepDays 原始数据表的保留天数，取 retention 配置，小于等于 0 为永久保留
+func keepDays(table string) int {
+	if conf.Sc == nil {
+		return 0
+	}
+	return conf.Sc.Retention.KeepDays(table, "raw")
+}
+
+// withPartitionLock 持有数据库命名锁时调用 fn，其他进程正在维护时返回 errPartitionLocked
+func withPartitionLock(conn *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return conn.Connection(func(tx *gorm.DB) error {
+		var got sql.NullInt64
+		if err := tx.Raw("SELECT GET_LOCK(?, 0)", partitionLock).Scan(&got).Error; err != nil {
+			return err
+		}
+		if got.Int64 != 1 {
+			return errPartitionLocked
+		}
+		defer tx.Exec("SELECT RELEASE_LOCK(?)", partitionLock)
+		return fn(tx)
+	})
+}
+
+// preparePartitions 空的未分区表直接改为分区表，已分区的表维护分区；
+// 已有数据的未分区表需用 moniter partition 迁移，不在写入路径上重建大表
+func preparePartitions(conn *gorm.DB, ahead int) error {
+	return withPartitionLock(conn, func(tx *gorm.DB) error {
+		now := time.Now()
+		for _, table := range partitionTables {
+			_, partitioned, err := partitions(tx, table)
+			if err != nil {
+				return err
+			}
+			if !partitioned {
+				var ids []uint
+				if err := tx.Table(table).Limit(1).Pluck("id", &ids).Error; err != nil {
+					return err
+				}
+				if len(ids) > 0 {
+					log.Printf("sink mysql table %s is not partitioned, run `moniter partition` to migrate", table)
+					continue
+				}
+				err := tx.Exec(fmt.Sprintf("ALTER TABLE `%s` %s %s",
+					table, partitionKeyClause, partitionClause(now, now.AddDate(0, 0, ahead)))).Error
+				if err != nil {
+					return fmt.Errorf("partition %s: %v", table, err)
+				}
+				log.Printf("sink mysql table %s partitioned by day", table)
+			}
+			if err := maintainPartitions(tx, table, ahead, keepDays(table), now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// maintainPartitions 预建今天起 ahead 天的分区，删除早于保留天数的分区；未分区的表跳过
+func maintainPartitions(conn *gorm.DB, table string, ahead, keep int, now time.Time) error {
+	days, partitioned, err := partitions(conn, table)
+	if err != nil || !partitioned {
+		return err
+	}
+
+	today := day(now)
+	from := today
+	if len(days) > 0 {
+		// 停机期间缺的分区一并补上，其数据已写入 pmax，拆分时移动到对应分区
+		from = days[len(days)-1].AddDate(0, 0, 1)
+	}
+	to := today.AddDate(0, 0, ahead)
+	if !from.After(to) {
+		err := conn.Exec(fmt.Sprintf("ALTER TABLE `%s` REORGANIZE PARTITION %s INTO (%s)",
+			table, partitionMax, strings.Join(partitionDefs(from, to), ", "))).Error
+		if err != nil {
+			return fmt.Errorf("add partitions to %s: %v", table, err)
+		}
+		log.Printf("sink mysql table %s added partitions %s to %s", table, partitionName(from), partitionName(to))
+	}
+
+	if keep <= 0 {
+		return nil
+	}
+	cutoff := today.AddDate(0, 0, -keep)
+	expired := make([]string, 0)
+	for _, d := range days {
+		if d.Before(cutoff) {
+			expired = append(expired, partitionName(d))
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	if err := conn.Exec(fmt.Sprintf("ALTER TABLE `%s` DROP PARTITION %s", table, strings.Join(expired, ", "))).Error; err != nil {
+		return fmt.Errorf("drop partitions of %s: %v", table, err)
+	}
+	log.Printf("sink mysql table %s dropped expired partitions %s", table, strings.Join(expired, ", "))
+	return nil
+}
+
+// migratePartitions 将已有数据的未分区表迁移为按天分区：按原表结构新建分区表，原子地互换表名后
+// 新数据立即写入分区表，再按 ID 分批将保留天数内的旧数据补写过去；原表改名为 <表名>_unpartitioned，
+// 核对后需手工删除。中断后重新执行会继续补写，已补写的行不会重复
+func migratePartitions(conn *gorm.DB, ahead int) error {
+	return withPartitionLock(conn, func(tx *gorm.DB) error {
+		for _, table := range partitionTables {
+			if err := migrateTable(tx, table, ahead, keepDays(table)); err != nil {
+				return fmt.Errorf("migrate %s: %v", table, err)
+			}
+			if err := maintainPartitions(tx, table, ahead, keepDays(table), time.Now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateTable 迁移一张表
+func migrateTable(conn *gorm.DB, table string, ahead, keep int) error {
+	old := table + "_unpartitioned"
+	tmp := table + "_partitioned"
+	now := time.Now()
+	var from time.Time
+	if keep > 0 {
+		from = day(now).AddDate(0, 0, -keep)
+	}
+
+	_, partitioned, err := partitions(conn, table)
+	if err != nil {
+		return err
+	}
+	if !partitioned {
+		// 永久保留时从最早的数据开始建分区，否则从保留天数开始，更早的数据不补写
+		first := from
+		if keep <= 0 {
+			var oldest sql.NullTime
+			if err := conn.Table(table).Select("MIN(timestamp)").Scan(&oldest).Error; err != nil {
+				return err
+			}
+			first = day(now)
+			if oldest.Valid && oldest.Time.Before(first) {
+				first = day(oldest.Time)
+			}
+		}
+		var maxID sql.NullInt64
+		if err := conn.Table(table).Select("MAX(id)").Scan(&maxID).Error; err != nil {
+			return err
+		}
+
+		stmts := []string{
+			fmt.Sprintf("DROP TABLE IF EXISTS `%s`", tmp),
+			fmt.Sprintf("CREATE TABLE `%s` LIKE `%s`", tmp, table),
+			fmt.Sprintf("ALTER TABLE `%s` %s, AUTO_INCREMENT = %d %s",
+				tmp, partitionKeyClause, maxID.Int64+autoIncrementGap, partitionClause(first, now.AddDate(0, 0, ahead))),
+			fmt.Sprintf("RENAME TABLE `%s` TO `%s`, `%s` TO `%s`", table, old, tmp, table),
+		}
+		for _, stmt := range stmts {
+			if err := conn.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		log.Printf("sink mysql table %s partitioned by day, old data is in %s", table, old)
+	}
+
+	if !conn.Migrator().HasTable(old) {
+		return nil
+	}
+	n, err := backfill(conn, old, table, from)
+	if err != nil {
+		return err
+	}
+	log.Printf("sink mysql table %s backfilled %d rows from %s, verify and DROP TABLE `%s`", table, n, old, old)
+	return nil
+}
+
+// backfill 按 ID 分批将 old 中 from 之后的数据补写到 table，已存在的行跳过
+func backfill(conn *gorm.DB, old, table string, from time.Time) (int64, error) {
+	var maxID sql.NullInt64
+	if err := conn.Table(old).Select("MAX(id)").Scan(&maxID).Error; err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("INSERT IGNORE INTO `%s` SELECT * FROM `%s` WHERE id >= ? AND id < ? AND timestamp >= ?", table, old)
+	var total int64
+	for lo := int64(0); lo <= maxID.Int64; lo += backfillChunk {
+		result := conn.Exec(query, lo, lo+backfillChunk, from)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+	}
+	return total, nil
+}
@@ -0,0 +1,184 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"moniter/model"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prometheusOptions prometheus 输出的配置项
+type prometheusOptions struct {
+	Listen     string `json:"listen"`      // 监听地址，默认 :9256
+	Path       string `json:"path"`        // 路径，默认 /metrics
+	StaleAfter int    `json:"stale_after"` // 进程超过该时间（秒）没有新数据则删除其指标，默认 60，需大于采集间隔
+}
+
+// promKinds 输出顺序
+var promKinds = []string{model.KindCPU, model.KindMemory, model.KindIO, model.KindTask}
+
+func init() {
+	Register("prometheus", func(name string, options json.RawMessage) (Sink, error) {
+		opts := prometheusOptions{Listen: ":9256", Path: "/metrics", StaleAfter: 60}
+		if err := decodeOptions(options, &opts); err != nil {
+			return nil, err
+		}
+		return NewPrometheus(name, opts.Listen, opts.Path, time.Duration(opts.StaleAfter)*time.Second)
+	})
+}
+
+// promKey 一个进程的一类数据
+type promKey struct {
+	kind string
+	tags model.Tags
+}
+
+// promSeries 最新一次数据及收到的时间
+type promSeries struct {
+	metric  model.Metric
+	updated time.Time
+}
+
+// Prometheus 保存每个进程最新一次的 CPU、内存、IO 数据，以 Prometheus 文本格式暴露为 gauge
+type Prometheus struct {
+	name       string
+	staleAfter time.Duration
+	server     *http.Server
+
+	mu     sync.Mutex
+	series map[promKey]promSeries
+}
+
+// NewPrometheus 创建 prometheus 输出并开始监听
+func NewPrometheus(name, listen, path string, staleAfter time.Duration) (*Prometheus, error) {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+	s := &Prometheus{
+		name:       name,
+		staleAfter: staleAfter,
+		series:     make(map[promKey]promSeries),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, s.serveMetrics)
+	s.server = &http.Server{Handler: mux}
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("sink %s serve ,err : %v", name, err)
+		}
+	}()
+	log.Printf("sink %s listening on %s%s", name, ln.Addr(), path)
+	return s, nil
+}
+
+// Name 输出名称
+func (s *Prometheus) Name() string {
+	return s.name
+}
+
+// Write 更新各进程的最新数据
+func (s *Prometheus) Write(rows interface{}) error {
+	metrics, err := model.Metrics(rows)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range metrics {
+		key := promKey{kind: m.Kind(), tags: m.Tags()}
+		// 同一批中可能有同一进程多个时刻的数据，只保留最新的
+		if old, ok := s.series[key]; ok && old.metric.Time().After(m.Time()) {
+			continue
+		}
+		s.series[key] = promSeries{metric: m, updated: now}
+	}
+	return nil
+}
+
+// Close 停止监听
+func (s *Prometheus) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// serveMetrics 输出 Prometheus 文本格式
+func (s *Prometheus) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(s.render(time.Now()))
+}
+
+// render 删除过期的进程后，按数据类型、列输出全部 gauge
+func (s *Prometheus) render(now time.Time) []byte {
+	s.mu.Lock()
+	byKind := make(map[string][]model.Metric)
+	for key, series := range s.series {
+		if s.staleAfter > 0 && now.Sub(series.updated) > s.staleAfter {
+			delete(s.series, key)
+			continue
+		}
+		byKind[key.kind] = append(byKind[key.kind], series.metric)
+	}
+	s.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, kind := range promKinds {
+		metrics := byKind[kind]
+		if len(metrics) == 0 {
+			continue
+		}
+		sort.Slice(metrics, func(i, j int) bool {
+			a, b := metrics[i].Tags(), metrics[j].Tags()
+			if a.IP != b.IP {
+				return a.IP < b.IP
+			}
+			if a.PID != b.PID {
+				return a.PID < b.PID
+			}
+			return a.Command < b.Command
+		})
+		for i, field := range metrics[0].Fields() {
+			name := promMetricName(kind, field.Name)
+			fmt.Fprintf(&buf, "# HELP %s %s\n", name, escapeHelp(field.Help))
+			fmt.Fprintf(&buf, "# TYPE %s gauge\n", name)
+			for _, m := range metrics {
+				pairs := m.Tags().Pairs()
+				labels := make([]string, len(pairs))
+				for j, pair := range pairs {
+					labels[j] = fmt.Sprintf("%s=\"%s\"", pair[0], escapeLabel(pair[1]))
+				}
+				fmt.Fprintf(&buf, "%s{%s} %s\n", name, strings.Join(labels, ","), strconv.FormatFloat(m.Values()[i], 'g', -1, 64))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// promMetricName 指标名，进程数据为 moniter_process_<类型>_<列名>，任务状态为 moniter_task_<列名>
+func promMetricName(kind, field string) string {
+	if kind == model.KindTask {
+		return "moniter_task_" + field
+	}
+	return "moniter_process_" + kind + "_" + field
+}
+
+// escapeHelp 转义 HELP 文本中的反斜杠与换行
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// escapeLabel 转义标签值中的反斜杠、双引号与换行
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
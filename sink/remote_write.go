@@ -0,0 +1,175 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"moniter/model"
+	"net/http"
+	"time"
+)
+
+// remoteWriteOptions remote_write 输出的配置项
+type remoteWriteOptions struct {
+	URL               string            `json:"url"`                  // 接收地址，如 http://prometheus:9090/api/v1/write
+	Headers           map[string]string `json:"headers"`              // 额外的请求头，如 Authorization
+	Timeout           int               `json:"timeout"`              // 单次请求超时（秒），默认 10
+	MaxRetries        int               `json:"max_retries"`          // 失败后的最大重试次数，默认 3
+	RetryBackoff      int               `json:"retry_backoff"`        // 首次重试等待时间（毫秒），之后每次翻倍，默认 500
+	MaxSamplesPerSend int               `json:"max_samples_per_send"` // 每个请求最多包含的样本数，默认 2000
+}
+
+func init() {
+	Register("remote_write", func(name string, options json.RawMessage) (Sink, error) {
+		opts := remoteWriteOptions{Timeout: 10, MaxRetries: 3, RetryBackoff: 500, MaxSamplesPerSend: 2000}
+		if err := decodeOptions(options, &opts); err != nil {
+			return nil, err
+		}
+		if opts.URL == "" {
+			return nil, fmt.Errorf("remote_write url is required")
+		}
+		return &RemoteWrite{
+			name:              name,
+			url:               opts.URL,
+			headers:           opts.Headers,
+			maxRetries:        opts.MaxRetries,
+			retryBackoff:      time.Duration(opts.RetryBackoff) * time.Millisecond,
+			maxSamplesPerSend: opts.MaxSamplesPerSend,
+			client:            &http.Client{Timeout: time.Duration(opts.Timeout) * time.Second},
+		}, nil
+	})
+}
+
+// RemoteWrite 将每批数据转为 Prometheus remote_write 请求（snappy 压缩的 protobuf WriteRequest）推送出去，
+// 用于无法被 Prometheus 拉取的主机
+type RemoteWrite struct {
+	name              string
+	url               string
+	headers           map[string]string
+	maxRetries        int
+	retryBackoff      time.Duration
+	maxSamplesPerSend int
+	client            *http.Client
+}
+
+// Name 输出名称
+func (s *RemoteWrite) Name() string {
+	return s.name
+}
+
+// Write 按 max_samples_per_send 拆分后依次推送，每列数据是一条时间序列
+func (s *RemoteWrite) Write(rows interface{}) error {
+	metrics, err := model.Metrics(rows)
+	if err != nil {
+		return err
+	}
+
+	var req []byte
+	samples := 0
+	for _, m := range metrics {
+		values := m.Values()
+		for i, field := range m.Fields() {
+			req = appendTimeSeries(req, promMetricName(m.Kind(), field.Name), m.Tags(), values[i], m.Time())
+			samples++
+			if samples >= s.maxSamplesPerSend {
+				if err := s.send(req); err != nil {
+					return err
+				}
+				req, samples = req[:0], 0
+			}
+		}
+	}
+	if samples > 0 {
+		return s.send(req)
+	}
+	return nil
+}
+
+// Close 关闭空闲连接
+func (s *RemoteWrite) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// send 推送一个 WriteRequest，网络错误、5xx、429 按指数退避重试
+func (s *RemoteWrite) send(req []byte) error {
+	body := snappyEncode(req)
+	backoff := s.retryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.maxRetries {
+			return err
+		}
+		log.Printf("sink %s remote write ,err : %v, retry in %s", s.name, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post 发送一次请求，返回失败时是否可以重试
+func (s *RemoteWrite) post(body []byte) (bool, error) {
+	httpReq, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", "moniter")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range s.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// appendTimeSeries 以 protobuf 编码追加 WriteRequest.timeseries（字段 1）
+//
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label      { string name = 1; string value = 2; }
+//	message Sample     { double value = 1; int64 timestamp = 2; }
+//
+// 标签需按名称排序
+func appendTimeSeries(b []byte, name string, tags model.Tags, value float64, ts time.Time) []byte {
+	var series []byte
+	for _, label := range append([][2]string{{"__name__", name}}, tags.Pairs()...) {
+		var l []byte
+		l = appendProtoBytes(l, 1, []byte(label[0]))
+		l = appendProtoBytes(l, 2, []byte(label[1]))
+		series = appendProtoBytes(series, 1, l)
+	}
+
+	var sample []byte
+	sample = binary.AppendUvarint(sample, 1<<3|1)
+	sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(value))
+	sample = binary.AppendUvarint(sample, 2<<3|0)
+	sample = binary.AppendUvarint(sample, uint64(ts.UnixMilli()))
+	series = appendProtoBytes(series, 2, sample)
+
+	return appendProtoBytes(b, 1, series)
+}
+
+// appendProtoBytes 追加一个 length-delimited 字段
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,379 @@
+package sink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"moniter/model"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sample 解码后的一条时间序列（remote_write 每条序列只有一个样本）
+type sample struct {
+	labels    [][2]string
+	value     float64
+	timestamp int64
+}
+
+// receiver 记录收到的 WriteRequest，按 statuses 依次返回状态码，用完后返回 200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests [][]sample
+	headers  []http.Header
+	errs     []error
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	var samples []sample
+	if err == nil {
+		var raw []byte
+		if raw, err = snappyDecode(body); err == nil {
+			samples, err = decodeWriteRequest(raw)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, samples)
+	r.headers = append(r.headers, req.Header.Clone())
+	if err != nil {
+		r.errs = append(r.errs, err)
+	}
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// newTestRemoteWrite 创建指向 srv 的输出，重试间隔很短
+func newTestRemoteWrite(srv *httptest.Server, maxSamplesPerSend int) *RemoteWrite {
+	return &RemoteWrite{
+		name:              "test",
+		url:               srv.URL,
+		maxRetries:        3,
+		retryBackoff:      time.Millisecond,
+		maxSamplesPerSend: maxSamplesPerSend,
+		client:            srv.Client(),
+	}
+}
+
+func TestRemoteWriteLabelsAndTimestamps(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 678e6, time.Local)
+	rows := []model.ProcessCPUStats{
+		{IP: "10.0.0.1", Timestamp: ts, PID: 42, User: "root", USR: 1.5, System: 2.5, Guest: 0, Wait: 0.25, Total: 4, Command: "nginx"},
+		{IP: "10.0.0.1", Timestamp: ts.Add(time.Second), PID: 7, Command: "kworker"},
+	}
+	if err := newTestRemoteWrite(srv, 2000).Write(rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.errs) > 0 {
+		t.Fatal(r.errs)
+	}
+	if len(r.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(r.requests))
+	}
+	h := r.headers[0]
+	for k, v := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	} {
+		if h.Get(k) != v {
+			t.Errorf("header %s = %q, want %q", k, h.Get(k), v)
+		}
+	}
+
+	got := r.requests[0]
+	want := []sample{
+		{[][2]string{{"__name__", "moniter_process_cpu_usr"}, {"command", "nginx"}, {"ip", "10.0.0.1"}, {"pid", "42"}, {"user", "root"}}, 1.5, ts.UnixMilli()},
+		{[][2]string{{"__name__", "moniter_process_cpu_system"}, {"command", "nginx"}, {"ip", "10.0.0.1"}, {"pid", "42"}, {"user", "root"}}, 2.5, ts.UnixMilli()},
+		{[][2]string{{"__name__", "moniter_process_cpu_guest"}, {"command", "nginx"}, {"ip", "10.0.0.1"}, {"pid", "42"}, {"user", "root"}}, 0, ts.UnixMilli()},
+		{[][2]string{{"__name__", "moniter_process_cpu_wait"}, {"command", "nginx"}, {"ip", "10.0.0.1"}, {"pid", "42"}, {"user", "root"}}, 0.25, ts.UnixMilli()},
+		{[][2]string{{"__name__", "moniter_process_cpu_total"}, {"command", "nginx"}, {"ip", "10.0.0.1"}, {"pid", "42"}, {"user", "root"}}, 4, ts.UnixMilli()},
+		// 空的 user 不作为标签
+		{[][2]string{{"__name__", "moniter_process_cpu_usr"}, {"command", "kworker"}, {"ip", "10.0.0.1"}, {"pid", "7"}}, 0, ts.Add(time.Second).UnixMilli()},
+	}
+	if len(got) != 10 {
+		t.Fatalf("got %d series, want 10", len(got))
+	}
+	for i, w := range want[:5] {
+		if !reflect.DeepEqual(got[i], w) {
+			t.Errorf("series %d = %v, want %v", i, got[i], w)
+		}
+	}
+	if !reflect.DeepEqual(got[5], want[5]) {
+		t.Errorf("series 5 = %v, want %v", got[5], want[5])
+	}
+}
+
+func TestRemoteWriteRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		wantErr  bool
+	}{
+		{"ok", nil, 1, false},
+		{"retry 503", []int{503, 200}, 2, false},
+		{"retry 500 twice", []int{500, 502, 200}, 3, false},
+		{"retry 429", []int{429, 200}, 2, false},
+		{"give up after max_retries", []int{503, 503, 503, 503, 503}, 4, true},
+		{"no retry on 400", []int{400}, 1, true},
+		{"no retry on 404", []int{404, 200}, 1, true},
+	}
+	rows := []model.ProcessIOStats{{IP: "10.0.0.1", Timestamp: time.Now(), PID: 1, Command: "sshd", ReadKBPS: 3}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &receiver{statuses: tt.statuses}
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			err := newTestRemoteWrite(srv, 2000).Write(rows)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(r.requests) != tt.requests {
+				t.Errorf("got %d requests, want %d", len(r.requests), tt.requests)
+			}
+			// 重试发送的是同一个请求
+			for i := 1; i < len(r.requests); i++ {
+				if !reflect.DeepEqual(r.requests[i], r.requests[0]) {
+					t.Errorf("request %d differs from the first", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteWriteMaxSamplesPerSend(t *testing.T) {
+	base := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	// 每行 5 个样本，共 15 个
+	rows := make([]model.ProcessCPUStats, 3)
+	for i := range rows {
+		rows[i] = model.ProcessCPUStats{IP: "10.0.0.1", Timestamp: base.Add(time.Duration(i) * time.Second), PID: i + 1, Command: "java"}
+	}
+
+	tests := []struct {
+		max   int
+		sizes []int
+	}{
+		{1, []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+		{4, []int{4, 4, 4, 3}},
+		{5, []int{5, 5, 5}},
+		{15, []int{15}},
+		{2000, []int{15}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.max), func(t *testing.T) {
+			r := &receiver{}
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			if err := newTestRemoteWrite(srv, tt.max).Write(rows); err != nil {
+				t.Fatal(err)
+			}
+			if len(r.errs) > 0 {
+				t.Fatal(r.errs)
+			}
+			sizes := make([]int, len(r.requests))
+			var all []sample
+			for i, req := range r.requests {
+				sizes[i] = len(req)
+				all = append(all, req...)
+			}
+			if !reflect.DeepEqual(sizes, tt.sizes) {
+				t.Errorf("request sizes = %v, want %v", sizes, tt.sizes)
+			}
+			// 拆分后按原顺序发送，不丢样本也不重复
+			for i, s := range all {
+				if want := base.Add(time.Duration(i/5) * time.Second).UnixMilli(); s.timestamp != want {
+					t.Errorf("sample %d timestamp = %d, want %d", i, s.timestamp, want)
+				}
+				if want := fmt.Sprint(i/5 + 1); label(s, "pid") != want {
+					t.Errorf("sample %d pid = %q, want %q", i, label(s, "pid"), want)
+				}
+			}
+		})
+	}
+}
+
+// label 按名称取标签值
+func label(s sample, name string) string {
+	for _, l := range s.labels {
+		if l[0] == name {
+			return l[1]
+		}
+	}
+	return ""
+}
+
+// snappyDecode 解压 snappy 块格式
+func snappyDecode(src []byte) ([]byte, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 {
+		return nil, fmt.Errorf("snappy: bad length")
+	}
+	src = src[k:]
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		tag := src[0]
+		var length, offset int
+		switch tag & 0x03 {
+		case 0x00:
+			length = int(tag>>2) + 1
+			src = src[1:]
+			if extra := int(tag>>2) - 59; extra > 0 {
+				if len(src) < extra {
+					return nil, fmt.Errorf("snappy: short literal length")
+				}
+				length = 1
+				for i := 0; i < extra; i++ {
+					length += int(src[i]) << (8 * i)
+				}
+				src = src[extra:]
+			}
+			if len(src) < length {
+				return nil, fmt.Errorf("snappy: short literal")
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 0x01:
+			if len(src) < 2 {
+				return nil, fmt.Errorf("snappy: short copy1")
+			}
+			length = int(tag>>2&0x07) + 4
+			offset = int(tag>>5)<<8 | int(src[1])
+			src = src[2:]
+		case 0x02:
+			if len(src) < 3 {
+				return nil, fmt.Errorf("snappy: short copy2")
+			}
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 0x03:
+			if len(src) < 5 {
+				return nil, fmt.Errorf("snappy: short copy4")
+			}
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, fmt.Errorf("snappy: bad offset %d", offset)
+		}
+		// 偏移小于长度时复制的内容会重叠，逐字节复制
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, fmt.Errorf("snappy: decoded %d bytes, want %d", len(dst), n)
+	}
+	return dst, nil
+}
+
+// decodeWriteRequest 解码 WriteRequest 中的全部时间序列
+func decodeWriteRequest(b []byte) ([]sample, error) {
+	var samples []sample
+	err := readProto(b, func(field int, data []byte, _ uint64) error {
+		if field != 1 {
+			return fmt.Errorf("WriteRequest: unexpected field %d", field)
+		}
+		var s sample
+		n := 0
+		err := readProto(data, func(field int, data []byte, _ uint64) error {
+			switch field {
+			case 1:
+				var l [2]string
+				return readProto(data, func(field int, data []byte, _ uint64) error {
+					if field < 1 || field > 2 {
+						return fmt.Errorf("Label: unexpected field %d", field)
+					}
+					l[field-1] = string(data)
+					if field == 2 {
+						s.labels = append(s.labels, l)
+					}
+					return nil
+				})
+			case 2:
+				n++
+				return readProto(data, func(field int, _ []byte, v uint64) error {
+					switch field {
+					case 1:
+						s.value = math.Float64frombits(v)
+					case 2:
+						s.timestamp = int64(v)
+					default:
+						return fmt.Errorf("Sample: unexpected field %d", field)
+					}
+					return nil
+				})
+			}
+			return fmt.Errorf("TimeSeries: unexpected field %d", field)
+		})
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			return fmt.Errorf("TimeSeries: %d samples, want 1", n)
+		}
+		samples = append(samples, s)
+		return nil
+	})
+	return samples, err
+}
+
+// readProto 依次读取 protobuf 字段，length-delimited 字段传入 data，varint 与 64 位字段传入 v
+func readProto(b []byte, handle func(field int, data []byte, v uint64) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("proto: bad key")
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		var data []byte
+		var v uint64
+		switch key & 0x07 {
+		case 0:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return fmt.Errorf("proto: bad varint")
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return fmt.Errorf("proto: short fixed64")
+			}
+			v = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return fmt.Errorf("proto: bad length")
+			}
+			data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return fmt.Errorf("proto: unsupported wire type %d", key&0x07)
+		}
+		if err := handle(field, data, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"moniter/conf"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sink 数据输出，异步任务攒够一批数据后写入全部已配置的输出
+type Sink interface {
+	// Name 输出名称
+	Name() string
+	// Write 写入一批数据，rows 为 []model.ProcessCPUStats、[]model.ProcessMemStats 或 []model.ProcessIOStats
+	Write(rows interface{}) error
+	// Close 写完缓存中的数据并释放连接
+	Close() error
+}
+
+// Factory 根据配置创建输出
+type Factory func(name string, options json.RawMessage) (Sink, error)
+
+// factories 输出类型注册表，类型 -> 工厂函数
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// sinks 已创建的输出
+var (
+	sinksMu sync.RWMutex
+	sinks   []Sink
+)
+
+// Register 注册输出类型，一般在输出所在文件的 init 中调用
+func Register(typ string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[typ]; ok {
+		panic(fmt.Sprintf("sink %s registered twice", typ))
+	}
+	factories[typ] = factory
+}
+
+// Types 已注册的输出类型
+func Types() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	types := make([]string, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Init 按配置创建全部输出，configs 为空时数据不输出到任何地方；配置了 spool.dir 时每个输出写入失败的数据暂存到磁盘
+func Init(configs []conf.SinkConfig, spool conf.SpoolConfig) error {
+	created := make([]Sink, 0, len(configs))
+	for _, c := range configs {
+		factoriesMu.RLock()
+		factory, ok := factories[c.Type]
+		factoriesMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("unknown sink type %q, available: %v", c.Type, Types())
+		}
+		s, err := factory(c.Name, c.Options)
+		if err != nil {
+			return fmt.Errorf("create sink %s: %v", c.Name, err)
+		}
+		if spool.Dir != "" {
+			if s, err = newSpool(s, spool); err != nil {
+				return fmt.Errorf("create spool for sink %s: %v", c.Name, err)
+			}
+		}
+		created = append(created, s)
+	}
+	if len(created) == 0 {
+		log.Printf("no sink configured, collected data will be discarded")
+	}
+
+	sinksMu.Lock()
+	sinks = created
+	sinksMu.Unlock()
+	return nil
+}
+
+// All 已创建的全部输出
+func All() []Sink {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	return append([]Sink(nil), sinks...)
+}
+
+// Write 将一批数据写入全部输出，某个输出失败不影响其余输出，返回全部失败原因
+func Write(rows interface{}) error {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	var errs []error
+	for _, s := range sinks {
+		// 每个输出写入自己的副本，mysql 输出会回写自增 ID
+		if err := s.Write(copyRows(rows)); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %v", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyRows 复制一批数据，rows 不是切片时原样返回
+func copyRows(rows interface{}) interface{} {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return rows
+	}
+	c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(c, v)
+	return c.Interface()
+}
+
+// Close 关闭全部输出
+func Close() error {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	var errs []error
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %v", s.Name(), err))
+		}
+	}
+	sinks = nil
+	return errors.Join(errs...)
+}
+
+// newSpool 按配置包装磁盘暂存
+func newSpool(s Sink, c conf.SpoolConfig) (Sink, error) {
+	maxSize := c.MaxSize
+	if maxSize <= 0 {
+		maxSize = 1024
+	}
+	interval := c.ReplayInterval
+	if interval <= 0 {
+		interval = 10
+	}
+	return NewSpool(s, filepath.Join(c.Dir, s.Name()), int64(maxSize)<<20, time.Duration(interval)*time.Second)
+}
+
+// decodeOptions 解析输出配置项，未配置时保持默认值
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	if len(options) == 0 || string(options) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(options, v); err != nil {
+		return fmt.Errorf("invalid sink options %s: %v", options, err)
+	}
+	return nil
+}
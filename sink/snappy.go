@@ -0,0 +1,83 @@
+package sink
+
+import "encoding/binary"
+
+// snappy 块格式压缩（remote_write 要求的格式，不是 framing 格式），只做简单的贪心匹配
+
+const (
+	// snappyBlockSize 每次在该长度内查找重复串，保证偏移量不超过 2 字节
+	snappyBlockSize = 1 << 16
+	// snappyTableBits 哈希表大小
+	snappyTableBits = 14
+)
+
+// snappyEncode 压缩 src
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+	for len(src) > 0 {
+		n := len(src)
+		if n > snappyBlockSize {
+			n = snappyBlockSize
+		}
+		dst = snappyEncodeBlock(dst, src[:n])
+		src = src[n:]
+	}
+	return dst
+}
+
+// snappyEncodeBlock 压缩不超过 snappyBlockSize 的一段数据
+func snappyEncodeBlock(dst, src []byte) []byte {
+	// table 记录 4 字节哈希最近一次出现的位置 + 1，0 表示未出现
+	var table [1 << snappyTableBits]int32
+	lit := 0
+	for i := 0; i+4 <= len(src); {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := (v * 0x1e35a7bd) >> (32 - snappyTableBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != v {
+			i++
+			continue
+		}
+
+		dst = snappyEmitLiteral(dst, src[lit:i])
+		j := i + 4
+		for j < len(src) && src[j] == src[candidate+j-i] {
+			j++
+		}
+		dst = snappyEmitCopy(dst, i-candidate, j-i)
+		i = j
+		lit = j
+	}
+	return snappyEmitLiteral(dst, src[lit:])
+}
+
+// snappyEmitLiteral 输出原样数据
+func snappyEmitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	default:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	}
+	return append(dst, lit...)
+}
+
+// snappyEmitCopy 输出对前面 offset 字节处 length 字节的引用，使用 2 字节偏移的 copy，每个最长 64 字节
+func snappyEmitCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > 64 {
+			n = 64
+		}
+		dst = append(dst, byte(n-1)<<2|0x02, byte(offset), byte(offset>>8))
+		length -= n
+	}
+	return dst
+}
@@ -0,0 +1,212 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"moniter/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spool 包装一个输出，写入失败时将这批数据暂存到磁盘，后台定期按时间顺序重新写入，
+// 数据库维护期间的数据不会丢失
+type Spool struct {
+	Sink
+	dir      string
+	maxSize  int64
+	interval time.Duration
+
+	mu   sync.Mutex // 保护 size 与暂存文件的增删
+	size int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSpool 创建磁盘暂存，dir 中已有的数据（上次运行留下的）也会重新写入
+func NewSpool(s Sink, dir string, maxSize int64, interval time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	sp := &Spool{
+		Sink:     s,
+		dir:      dir,
+		maxSize:  maxSize,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, path := range sp.files() {
+		if info, err := os.Stat(path); err == nil {
+			sp.size += info.Size()
+		}
+	}
+	go sp.replayLoop()
+	return sp, nil
+}
+
+// Write 写入被包装的输出，失败时暂存到磁盘；暂存成功也返回写入的错误，
+// 调用方照常计入失败（数据不会丢失，稍后重新写入）
+func (s *Spool) Write(rows interface{}) error {
+	err := s.Sink.Write(rows)
+	if err == nil {
+		return nil
+	}
+	if serr := s.save(rows); serr != nil {
+		return fmt.Errorf("%v, spool failed: %v", err, serr)
+	}
+	return fmt.Errorf("%v, batch spooled for replay", err)
+}
+
+// Close 停止重新写入后关闭被包装的输出，未写入的数据留在磁盘上，下次启动时继续
+func (s *Spool) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.Sink.Close()
+}
+
+// save 将一批数据以 JSONL 格式保存为一个文件，超出容量时删除最旧的文件
+func (s *Spool) save(rows interface{}) error {
+	metrics, err := model.Metrics(rows)
+	if err != nil || len(metrics) == 0 {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		if err := encodeRow(&buf, FormatJSONL, m); err != nil {
+			return err
+		}
+	}
+	n := int64(buf.Len())
+	if n > s.maxSize {
+		return fmt.Errorf("batch of %d bytes exceeds spool size %d", n, s.maxSize)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, path := range s.files() {
+		if s.size+n <= s.maxSize {
+			break
+		}
+		log.Printf("sink %s spool full, drop %s", s.Name(), path)
+		s.remove(path)
+	}
+
+	// 文件名中的时间用于排序，先写临时文件再改名，重新写入时不会读到写了一半的文件
+	path := filepath.Join(s.dir, fmt.Sprintf("%s-%020d.%s", metrics[0].Kind(), time.Now().UnixNano(), FormatJSONL))
+	if err := os.WriteFile(path+".tmp", buf.Bytes(), 0644); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	s.size += n
+	return nil
+}
+
+// files 暂存文件，按保存时间从旧到新排序
+func (s *Spool) files() []string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && IsDataFile(entry.Name()) {
+			paths = append(paths, filepath.Join(s.dir, entry.Name()))
+		}
+	}
+	savedAt := func(path string) string {
+		name := filepath.Base(path)
+		return name[strings.IndexByte(name, '-')+1:]
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return savedAt(paths[i]) < savedAt(paths[j])
+	})
+	return paths
+}
+
+// remove 删除暂存文件并扣减容量，调用方需持有 mu
+func (s *Spool) remove(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("sink %s remove %s ,err : %v", s.Name(), path, err)
+		return
+	}
+	s.size -= info.Size()
+}
+
+// replayLoop 每个间隔尝试重新写入一次，直到 Close
+func (s *Spool) replayLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.replay()
+		}
+	}
+}
+
+// replay 从最旧的文件开始逐个写入被包装的输出，遇到失败说明输出仍不可用，等下一个间隔再试
+func (s *Spool) replay() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		s.mu.Lock()
+		paths := s.files()
+		s.mu.Unlock()
+		if len(paths) == 0 {
+			return
+		}
+		path := paths[0]
+
+		var metrics []model.Metric
+		err := ReadFile(path, func(m model.Metric) error {
+			metrics = append(metrics, m)
+			return nil
+		})
+		var rows interface{}
+		if err == nil {
+			rows, err = model.Rows(metrics)
+		}
+		if os.IsNotExist(err) {
+			// 暂存已满时被删除
+			continue
+		}
+		if err != nil {
+			// 无法解析的文件重试也不会成功
+			log.Printf("sink %s drop unreadable spool file %s ,err : %v", s.Name(), path, err)
+			s.mu.Lock()
+			s.remove(path)
+			s.mu.Unlock()
+			continue
+		}
+
+		if err := s.Sink.Write(rows); err != nil {
+			log.Printf("sink %s replay ,err : %v, %d spooled files left", s.Name(), err, len(paths))
+			return
+		}
+		s.mu.Lock()
+		s.remove(path)
+		s.mu.Unlock()
+		log.Printf("sink %s replayed %d rows from %s", s.Name(), len(metrics), filepath.Base(path))
+	}
+}
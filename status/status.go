@@ -0,0 +1,132 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"moniter/async"
+	"moniter/conf"
+	"moniter/model"
+	"moniter/rollup"
+	"moniter/sink"
+	"moniter/supervisor"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// running 定期写入的 goroutine
+var running sync.WaitGroup
+
+// Snapshot 当前运行状态
+type Snapshot struct {
+	Time       time.Time           `json:"time"`
+	Collectors []supervisor.Status `json:"collectors"` // 各采集器的运行状态
+	Tasks      []async.Stats       `json:"tasks"`      // 各异步写入任务的队列、批次与写出统计
+	Rollup     rollup.Status       `json:"rollup"`     // 增量汇总的最近一次结果
+}
+
+// Current 采集当前运行状态
+func Current() Snapshot {
+	return Snapshot{
+		Time:       time.Now(),
+		Collectors: supervisor.Statuses(),
+		Tasks:      async.AllStats(),
+		Rollup:     rollup.CurrentStatus(),
+	}
+}
+
+// Start 按配置启动 HTTP 状态接口（GET /status 返回 JSON）与异步任务状态的定期写入，ctx 取消后停止
+func Start(ctx context.Context, c conf.StatusConfig) error {
+	if c.Listen != "" {
+		ln, err := net.Listen("tcp", c.Listen)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/status", serveStatus)
+		server := &http.Server{Handler: mux}
+		go func() {
+			if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Printf("status serve ,err : %v", err)
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		log.Printf("status listening on %s", ln.Addr())
+	}
+
+	if c.Interval > 0 {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			report(ctx, time.Duration(c.Interval)*time.Second)
+		}()
+	}
+	return nil
+}
+
+// Wait 等待定期写入退出（需先取消 Start 时传入的 ctx），关闭输出前调用；ctx 到期后返回 ctx 的错误，不再等待正在重试的写入
+func Wait(ctx context.Context) error {
+	return async.WaitGroup(ctx, &running)
+}
+
+// serveStatus 输出 JSON 格式的运行状态
+func serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(Current())
+}
+
+// report 每个间隔将各异步任务的状态作为一批 TaskStats 写入全部输出；
+// 不经过异步任务，写入卡住时也能从状态接口看到
+func report(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			stats := async.AllStats()
+			if len(stats) == 0 {
+				continue
+			}
+			rows := make([]model.TaskStats, len(stats))
+			for i, s := range stats {
+				rows[i] = taskStats(now, s)
+			}
+			if err := sink.Write(rows); err != nil {
+				log.Printf("status Write ,err : %v", err)
+			}
+		}
+	}
+}
+
+// taskStats 转为写入输出的行
+func taskStats(now time.Time, s async.Stats) model.TaskStats {
+	return model.TaskStats{
+		IP:             conf.Sc.IP,
+		Timestamp:      now,
+		Task:           s.Name,
+		Queued:         float64(s.Queued),
+		Published:      float64(s.Published),
+		Dropped:        float64(s.Dropped),
+		Spilled:        float64(s.Spilled),
+		Flushed:        float64(s.Flushed),
+		Failed:         float64(s.Failed),
+		Errors:         float64(s.Errors),
+		Batches:        float64(s.Batches),
+		LastBatchSize:  float64(s.LastBatchSize),
+		MaxBatchSize:   float64(s.MaxBatchSize),
+		AvgBatchSize:   s.AvgBatchSize,
+		LastFlushMs:    s.LastFlushMs,
+		MaxFlushMs:     s.MaxFlushMs,
+		AvgFlushMs:     s.AvgFlushMs,
+		SinceLastFlush: s.SinceLastFlush,
+	}
+}
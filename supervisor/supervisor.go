@@ -0,0 +1,159 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"moniter/async"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// minBackoff 首次重启等待时间
+	minBackoff = time.Second
+	// maxBackoff 最大重启等待时间，运行超过该时长视为恢复正常，退避时间重置
+	maxBackoff = time.Minute
+)
+
+// supervisors 全部守护的采集器，名称 -> Supervisor
+var (
+	mu          sync.Mutex
+	supervisors = make(map[string]*Supervisor)
+	running     sync.WaitGroup
+)
+
+// Status 采集器运行状态
+type Status struct {
+	Name      string    `json:"name"`
+	Up        bool      `json:"up"`         // 是否正在运行
+	Restarts  int       `json:"restarts"`   // 重启次数
+	LastError string    `json:"last_error"` // 最近一次退出原因
+	StartedAt time.Time `json:"started_at"` // 最近一次启动时间
+	DownSince time.Time `json:"down_since"` // 最近一次退出时间，Up 为 true 时为零值
+}
+
+// Supervisor 守护一个采集器，退出后按指数退避重启
+type Supervisor struct {
+	run    func(ctx context.Context) error
+	mu     sync.Mutex
+	status Status
+}
+
+// New 创建并登记采集器守护
+func New(name string, run func(ctx context.Context) error) *Supervisor {
+	s := &Supervisor{
+		run:    run,
+		status: Status{Name: name},
+	}
+	mu.Lock()
+	supervisors[name] = s
+	mu.Unlock()
+	return s
+}
+
+// Start 在后台运行采集器，退出后自动重启直到 ctx 取消
+func (s *Supervisor) Start(ctx context.Context) {
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		backoff := minBackoff
+		for {
+			started := s.started()
+			s.exited(s.safeRun(ctx))
+			if ctx.Err() != nil {
+				log.Printf("collector %s stopped", s.status.Name)
+				return
+			}
+
+			// 运行了足够长的时间说明已经恢复过，重新从最小退避开始
+			if time.Since(started) > maxBackoff {
+				backoff = minBackoff
+			}
+			log.Printf("collector %s down: %s, restart in %s", s.status.Name, s.Status().LastError, backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}()
+}
+
+// Status 当前运行状态
+func (s *Supervisor) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// safeRun 运行采集器，panic 也视为一次退出
+func (s *Supervisor) safeRun(ctx context.Context) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return s.run(ctx)
+}
+
+// started 记录一次启动
+func (s *Supervisor) started() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.status.StartedAt.IsZero() {
+		s.status.Restarts++
+	}
+	s.status.Up = true
+	s.status.StartedAt = time.Now()
+	s.status.DownSince = time.Time{}
+	log.Printf("collector %s started", s.status.Name)
+	return s.status.StartedAt
+}
+
+// exited 记录一次退出
+func (s *Supervisor) exited(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Up = false
+	s.status.DownSince = time.Now()
+	if err == nil {
+		err = fmt.Errorf("collector returned without error")
+	}
+	s.status.LastError = err.Error()
+}
+
+// Wait 等待所有采集器退出（需先取消 Start 时传入的 ctx），ctx 到期后返回 ctx 的错误
+func Wait(ctx context.Context) error {
+	return async.WaitGroup(ctx, &running)
+}
+
+// Statuses 所有采集器的运行状态，按名称排序
+func Statuses() []Status {
+	mu.Lock()
+	defer mu.Unlock()
+	statuses := make([]Status, 0, len(supervisors))
+	for _, s := range supervisors {
+		statuses = append(statuses, s.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Down 已退出、等待重启的采集器
+func Down() []Status {
+	down := make([]Status, 0)
+	for _, status := range Statuses() {
+		if !status.Up {
+			down = append(down, status)
+		}
+	}
+	return down
+}
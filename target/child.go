@@ -0,0 +1,39 @@
+package target
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// startPidstat 启动 pidstat 子进程，ctx 取消时子进程被结束，返回其标准输出
+func startPidstat(ctx context.Context, args ...string) (*exec.Cmd, io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, "pidstat", args...)
+	cmd.Env = append(os.Environ(), pidstatEnv...)
+	// agent 异常退出时由内核结束子进程，避免遗留孤儿进程
+	setPdeathsig(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating stdout pipe: %v", err)
+	}
+
+	// 启动命令
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("error starting pidstat: %v", err)
+	}
+	return cmd, stdout, nil
+}
+
+// waitPidstat 等待子进程退出，ctx 取消导致的退出视为正常停止
+func waitPidstat(ctx context.Context, cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("pidstat exited: %v", err)
+	}
+	return fmt.Errorf("pidstat exited unexpectedly")
+}
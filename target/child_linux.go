@@ -0,0 +1,11 @@
+package target
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setPdeathsig 父进程退出时向子进程发送 SIGKILL
+func setPdeathsig(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package target
+
+import "os/exec"
+
+// setPdeathsig 非 Linux 平台不支持 Pdeathsig
+func setPdeathsig(cmd *exec.Cmd) {}
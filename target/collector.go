@@ -0,0 +1,141 @@
+package target
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"moniter/async"
+	"moniter/matcher"
+	"moniter/sink"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Collector 采集器，StartMonitoring 阻塞运行直到 ctx 取消或出错
+type Collector interface {
+	StartMonitoring(ctx context.Context) error
+}
+
+// CollectorConfig 创建采集器所需的配置
+type CollectorConfig struct {
+	Matcher  *matcher.Matcher // 要监控的进程匹配规则
+	Interval int              // 监控间隔（秒）
+	Options  json.RawMessage  // 采集器自身的配置项，由各采集器自行解析
+}
+
+// Factory 根据配置创建采集器
+type Factory func(cfg CollectorConfig) (Collector, error)
+
+// factories 采集器注册表，名称 -> 工厂函数
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register 注册采集器，一般在采集器所在文件的 init 中调用
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("collector %s registered twice", name))
+	}
+	factories[name] = factory
+}
+
+// NewCollector 按名称创建采集器
+func NewCollector(name string, cfg CollectorConfig) (Collector, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown collector %q, available: %v", name, Collectors())
+	}
+	return factory(cfg)
+}
+
+// Collectors 已注册的采集器名称
+func Collectors() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// backendOptions cpu、memory、io 采集器的配置项
+type backendOptions struct {
+	Backend string `json:"backend"` // 采集方式：pidstat（默认）或 proc
+}
+
+// decodeOptions 解析采集器配置项，未配置时保持默认值
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	if len(options) == 0 || string(options) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(options, v); err != nil {
+		return fmt.Errorf("invalid collector options %s: %v", options, err)
+	}
+	return nil
+}
+
+// runPidstat 运行 pidstat 并逐行回调数据行（已跳过首行、列头、Average 行），子进程退出后返回
+func runPidstat(ctx context.Context, args []string, handle func(h *pidstatHeader, ts time.Time, line string)) error {
+	cmd, stdout, err := startPidstat(ctx, args...)
+	if err != nil {
+		return err
+	}
+
+	// 创建 scanner 读取输出
+	scanner := bufio.NewScanner(stdout)
+
+	// 记录首行日期与当前列头，每个采样周期 pidstat 都会重新输出一次列头
+	stream := &pidstatStream{}
+
+	// 处理每一行输出
+	for scanner.Scan() {
+		line := scanner.Text()
+		header, ts, ok, err := stream.parseLine(line)
+		if err != nil {
+			log.Printf("Error parsing line '%s': %v", line, err)
+			continue
+		}
+		if ok {
+			handle(header, ts, line)
+		}
+	}
+
+	return waitPidstat(ctx, cmd)
+}
+
+// runTicker 每个采样间隔调用一次 sample，直到 ctx 取消或 sample 出错
+func runTicker(ctx context.Context, interval int, sample func(now time.Time) error) error {
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if err := sample(now); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// addSinkConsumers 每个输出作为异步任务的一个 consumer，各自排队写出，慢的输出不影响采集与其他输出
+func addSinkConsumers[T any](task *async.Task[T]) {
+	for _, s := range sink.All() {
+		s := s
+		task.AddConsumer(s.Name(), func(data []T) error {
+			return s.Write(data)
+		})
+	}
+}
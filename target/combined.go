@@ -0,0 +1,158 @@
+package target
+
+import (
+	"context"
+	"log"
+	"moniter/matcher"
+	"strconv"
+	"time"
+)
+
+// combinedOptions pidstat 合并采集器的配置项，指定需要的段落，默认全部采集
+type combinedOptions struct {
+	CPU    *bool `json:"cpu"`
+	Memory *bool `json:"memory"`
+	IO     *bool `json:"io"`
+}
+
+func init() {
+	Register("pidstat", func(cfg CollectorConfig) (Collector, error) {
+		var opts combinedOptions
+		if err := decodeOptions(cfg.Options, &opts); err != nil {
+			return nil, err
+		}
+		enabled := func(v *bool) bool { return v == nil || *v }
+		return NewCombinedMonitor(cfg.Matcher, cfg.Interval, enabled(opts.CPU), enabled(opts.Memory), enabled(opts.IO)), nil
+	})
+}
+
+// ProcessSample 同一采样时刻同一进程的 CPU、内存、IO 数据，pidstat 未输出的部分为 nil
+type ProcessSample struct {
+	Timestamp time.Time
+	PID       int
+	CPU       *ProcessCPUStats
+	Memory    *ProcessMemStats
+	IO        *ProcessIOStats
+}
+
+// CombinedMonitor 合并采集器，一个 pidstat 子进程输出多个段落，按列头拆分后以 PID 关联
+type CombinedMonitor struct {
+	matcher  *matcher.Matcher // 要监控的进程匹配规则
+	interval int              // 监控间隔（秒）
+	cpu      bool             // 是否采集 CPU（-u）
+	memory   bool             // 是否采集内存（-r）
+	io       bool             // 是否采集 IO（-d）
+}
+
+// NewCombinedMonitor 创建合并采集器，cpu、memory、io 指定需要的段落
+func NewCombinedMonitor(m *matcher.Matcher, interval int, cpu, memory, io bool) *CombinedMonitor {
+	if cpu {
+		initCPUStorage()
+	}
+	if memory {
+		initMemoryStorage()
+	}
+	if io {
+		initIOStorage()
+	}
+	return &CombinedMonitor{
+		matcher:  m,
+		interval: interval,
+		cpu:      cpu,
+		memory:   memory,
+		io:       io,
+	}
+}
+
+// StartMonitoring 开始合并采集
+func (m *CombinedMonitor) StartMonitoring(ctx context.Context) error {
+	args := make([]string, 0, 4)
+	if m.cpu {
+		args = append(args, "-u")
+	}
+	if m.memory {
+		args = append(args, "-r")
+	}
+	if m.io {
+		args = append(args, "-d")
+	}
+
+	// 当前采样周期内已收到的数据，采样时间变化时整体发布
+	var pendingTime time.Time
+	pending := make(map[int]*ProcessSample)
+	flush := func() {
+		for _, sample := range pending {
+			m.publish(sample)
+		}
+		pending = make(map[int]*ProcessSample)
+	}
+
+	err := runPidstat(ctx, append(args, strconv.Itoa(m.interval)), func(h *pidstatHeader, ts time.Time, line string) {
+		if !ts.Equal(pendingTime) {
+			flush()
+			pendingTime = ts
+		}
+		if err := m.collect(pending, h, ts, line); err != nil {
+			log.Printf("Error parsing line '%s': %v", line, err)
+		}
+	})
+	flush()
+	return err
+}
+
+// collect 解析一行数据并合并到对应 PID 的样本中，-h 模式下一行包含全部段落
+func (m *CombinedMonitor) collect(pending map[int]*ProcessSample, h *pidstatHeader, ts time.Time, line string) error {
+	row, err := newPidstatRow(h, line)
+	if err != nil {
+		return err
+	}
+	pid, err := row.pid()
+	if err != nil {
+		return err
+	}
+	// 检查是否是目标进程
+	if !m.matcher.Match(matcher.Process{PID: pid, Comm: row.command(), User: row.str("UID")}) {
+		return nil
+	}
+
+	sample, ok := pending[pid]
+	if !ok {
+		sample = &ProcessSample{Timestamp: ts, PID: pid}
+		pending[pid] = sample
+	}
+	if h.cpu && m.cpu {
+		stats, err := parseCPUStats(h, ts, line)
+		if err != nil {
+			return err
+		}
+		sample.CPU = &stats
+	}
+	if h.memory && m.memory {
+		stats, err := parseMemoryStats(h, ts, line)
+		if err != nil {
+			return err
+		}
+		sample.Memory = &stats
+	}
+	if h.io && m.io {
+		stats, err := parseIOStats(h, ts, line)
+		if err != nil {
+			return err
+		}
+		sample.IO = &stats
+	}
+	return nil
+}
+
+// publish 将一个样本的各部分推入对应的异步任务，同一样本的时间与 PID 完全一致，可按此关联
+func (m *CombinedMonitor) publish(sample *ProcessSample) {
+	if sample.CPU != nil {
+		publishCPU(*sample.CPU)
+	}
+	if sample.Memory != nil {
+		publishMemory(*sample.Memory)
+	}
+	if sample.IO != nil {
+		publishIO(*sample.IO)
+	}
+}
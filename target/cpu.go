@@ -1,173 +1,126 @@
 package target
 
 import (
-	"bufio"
-	"fmt"
+	"context"
 	"log"
 	"moniter/async"
 	"moniter/conf"
-	"moniter/db"
-	"os/exec"
+	"moniter/matcher"
+	"moniter/model"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
-// ProcessCPUStats 存储进程 CPU 统计信息
-type ProcessCPUStats struct {
-	ID        uint      `gorm:"primaryKey"` // 主键
-	IP        string    `gorm:"type:varchar(50);not null"`
-	Timestamp time.Time `gorm:"type:datetime"`          // 时间戳
-	PID       int       `gorm:"column:pid;not null"`    // 进程 ID
-	User      string    `gorm:"column:user;not null"`   // 用户名
-	USR       float64   `gorm:"column:usr;not null"`    // 用户空间 CPU 使用率
-	System    float64   `gorm:"column:system;not null"` // 系统空间 CPU 使用率
-	Guest     float64   `gorm:"column:guest;not null"`  // 虚拟 CPU 使用率
-	Wait      float64   `gorm:"column:wait;not null"`
-	Total     float64   `gorm:"column:total;not null"`   // 总 CPU 使用率
-	Command   string    `gorm:"column:command;not null"` // 命令
-}
+// ProcessCPUStats 见 model.ProcessCPUStats
+type ProcessCPUStats = model.ProcessCPUStats
 
 // CPUMonitor CPU 监控器
 type CPUMonitor struct {
-	processes []string // 要监控的进程名列表
-	interval  int      // 监控间隔（秒）
+	matcher  *matcher.Matcher // 要监控的进程匹配规则
+	interval int              // 监控间隔（秒）
+	backend  string           // 采集方式：pidstat 或 proc
+}
+
+// cpuStorageOnce 保证异步任务只初始化一次
+var cpuStorageOnce sync.Once
+
+func init() {
+	Register("cpu", func(cfg CollectorConfig) (Collector, error) {
+		var opts backendOptions
+		if err := decodeOptions(cfg.Options, &opts); err != nil {
+			return nil, err
+		}
+		return NewCPUMonitor(cfg.Matcher, cfg.Interval, opts.Backend), nil
+	})
 }
 
 // NewCPUMonitor 创建新的 CPU 监控器
-func NewCPUMonitor(processes []string, interval int) *CPUMonitor {
-	db.DBConn.AutoMigrate(&ProcessCPUStats{})
-	cpuTask := async.CPUTask()
-	cpuTask.SetConsumer(BatchCreateCPU)
-	cpuTask.Async()
+func NewCPUMonitor(m *matcher.Matcher, interval int, backend string) *CPUMonitor {
+	initCPUStorage()
 	return &CPUMonitor{
-		processes: processes,
-		interval:  interval,
+		matcher:  m,
+		interval: interval,
+		backend:  backend,
 	}
 }
 
-// StartMonitoring 开始监控进程 CPU 使用情况
-func (m *CPUMonitor) StartMonitoring() error {
-	// 构建 pidstat 命令
-	cmd := exec.Command("pidstat", "-u", strconv.Itoa(m.interval))
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("error creating stdout pipe: %v", err)
-	}
-
-	// 启动命令
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("error starting pidstat: %v", err)
-	}
+// initCPUStorage 启动 CPU 异步写入任务，可重复调用
+func initCPUStorage() {
+	cpuStorageOnce.Do(func() {
+		task := cpuTask()
+		addSinkConsumers(task)
+		task.Async()
+	})
+}
 
-	// 创建 scanner 读取输出
-	scanner := bufio.NewScanner(stdout)
+// cpuTask CPU 异步写入任务
+func cpuTask() *async.Task[ProcessCPUStats] {
+	return async.GetTask[ProcessCPUStats]("cpu")
+}
 
-	// 跳过头部信息
-	for i := 0; i < 3; i++ {
-		scanner.Scan()
+// StartMonitoring 开始监控进程 CPU 使用情况
+func (m *CPUMonitor) StartMonitoring(ctx context.Context) error {
+	if m.backend == BackendProc {
+		return m.startProcMonitoring(ctx)
 	}
+	return m.startPidstatMonitoring(ctx)
+}
 
-	//// 打印表头
-	//fmt.Printf("%-20s %-8s %-10s %-8s %-8s %-8s %-8s %s\n",
-	//	"Timestamp", "PID", "User", "%USR", "%System", "%Guest", "%CPU", "Command")
-	//fmt.Println(strings.Repeat("-", 90))
-
-	// 处理每一行输出
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.TrimSpace(line) == "" {
-			continue
+// startPidstatMonitoring 通过 pidstat -u 采集进程 CPU 使用情况
+func (m *CPUMonitor) startPidstatMonitoring(ctx context.Context) error {
+	return runPidstat(ctx, []string{"-u", strconv.Itoa(m.interval)}, func(h *pidstatHeader, ts time.Time, line string) {
+		if !h.cpu {
+			return
 		}
-
-		// 检查是否是目标进程
-		isTargetProcess := false
-		for _, process := range m.processes {
-			if strings.Contains(line, process) {
-				isTargetProcess = true
-				break
-			}
+		stats, err := parseCPUStats(h, ts, line)
+		if err != nil {
+			log.Printf("Error parsing line '%s': %v", line, err)
+			return
 		}
-
-		if isTargetProcess {
-			stats, err := parseCPUStats(line)
-			if err != nil {
-				log.Printf("Error parsing line '%s': %v", line, err)
-				continue
-			}
-			if err = async.CPUTask().Pub(stats); err != nil {
-				if err = db.DBConn.Create(&stats).Error; err != nil {
-					log.Printf("CPUMonitor Create ,err : %v", err)
-					continue
-				}
-			}
-
+		// 检查是否是目标进程
+		if !m.matcher.Match(matcher.Process{PID: stats.PID, Comm: stats.Command, User: stats.User}) {
+			return
 		}
-	}
-
-	return cmd.Wait()
+		publishCPU(stats)
+	})
 }
 
-func BatchCreateCPU(data []interface{}) {
-	cpuData := make([]ProcessCPUStats, len(data))
-	for i, i2 := range data {
-		cpuData[i] = i2.(ProcessCPUStats)
-	}
-	if err := db.DBConn.CreateInBatches(cpuData, 1000).Error; err != nil {
-		log.Printf("IOMonitor CreateInBatches ,err : %v", err)
-	}
+// publishCPU 推入异步任务，channel 已满时按任务的 overflow 策略处理，丢弃的数据由任务计数
+func publishCPU(stats ProcessCPUStats) {
+	cpuTask().Pub(stats)
 }
 
-// parseCPUStats 解析 pidstat 输出行
-func parseCPUStats(line string) (ProcessCPUStats, error) {
-
-	fields := strings.Fields(line)
-	if len(fields) < 8 {
-		return ProcessCPUStats{}, fmt.Errorf("invalid line format: %s", line)
-	}
-
-	// 解析 PID
-	pid, err := strconv.Atoi(fields[2])
-	if err != nil {
-		return ProcessCPUStats{}, fmt.Errorf("error parsing PID: %v", err)
-	}
-
-	// 解析 CPU 使用率数据
-	usr, err := strconv.ParseFloat(fields[4], 64)
+// parseCPUStats 按列头解析 pidstat 输出行
+func parseCPUStats(h *pidstatHeader, ts time.Time, line string) (ProcessCPUStats, error) {
+	row, err := newPidstatRow(h, line)
 	if err != nil {
-		return ProcessCPUStats{}, fmt.Errorf("error parsing USR: %v", err)
+		return ProcessCPUStats{}, err
 	}
 
-	system, err := strconv.ParseFloat(fields[5], 64)
-	if err != nil {
-		return ProcessCPUStats{}, fmt.Errorf("error parsing System: %v", err)
-	}
-
-	guest, err := strconv.ParseFloat(fields[6], 64)
-	if err != nil {
-		return ProcessCPUStats{}, fmt.Errorf("error parsing Guest: %v", err)
-	}
-	wait, err := strconv.ParseFloat(fields[7], 64)
+	// 解析 PID
+	pid, err := row.pid()
 	if err != nil {
-		return ProcessCPUStats{}, fmt.Errorf("error parsing Guest: %v", err)
+		return ProcessCPUStats{}, err
 	}
 
-	total, err := strconv.ParseFloat(fields[8], 64)
+	// 解析 CPU 使用率数据，旧版本 sysstat 没有 %wait 列
+	values, err := row.floats("%usr", "%system", "%guest", "%wait", "%CPU")
 	if err != nil {
-		return ProcessCPUStats{}, fmt.Errorf("error parsing Total CPU: %v", err)
+		return ProcessCPUStats{}, err
 	}
 
 	return ProcessCPUStats{
 		IP:        conf.Sc.IP,
 		PID:       pid,
-		User:      fields[3],
-		USR:       usr,
-		System:    system,
-		Guest:     guest,
-		Wait:      wait,
-		Total:     total,
-		Command:   fields[len(fields)-1],
-		Timestamp: time.Now(),
+		User:      row.str("UID"),
+		USR:       values[0],
+		System:    values[1],
+		Guest:     values[2],
+		Wait:      values[3],
+		Total:     values[4],
+		Command:   row.command(),
+		Timestamp: ts,
 	}, nil
 }
 
@@ -185,9 +138,3 @@ func parseCPUStats(line string) (ProcessCPUStats, error) {
 //		log.Fatalf("Error during monitoring: %v", err)
 //	}
 //}
-
-// 添加信号处理，支持优雅退出
-func init() {
-	// 可以添加信号处理代码
-	// 比如处理 Ctrl+C 等中断信号
-}
@@ -0,0 +1,184 @@
+package target
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"moniter/conf"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicksPerSecond USER_HZ，Linux 上固定为 100
+const clockTicksPerSecond = 100
+
+// procCPUTimes 进程在某一时刻的 CPU 累计时间
+type procCPUTimes struct {
+	utime     uint64 // 用户态 jiffies（含 guest）
+	stime     uint64 // 内核态 jiffies
+	guestTime uint64 // 虚拟 CPU jiffies
+	waitNS    uint64 // 等待调度的时间（纳秒）
+}
+
+// startProcMonitoring 基于 /proc/[pid]/stat 与 /proc/stat 的差值计算 CPU 使用率
+func (m *CPUMonitor) startProcMonitoring(ctx context.Context) error {
+	lastTotal, cpuNum, err := readTotalJiffies()
+	if err != nil {
+		return err
+	}
+	lastTimes := m.sampleCPUTimes()
+
+	return runTicker(ctx, m.interval, func(now time.Time) error {
+		total, _, err := readTotalJiffies()
+		if err != nil {
+			return err
+		}
+		// 单个 CPU 在采样间隔内经过的 jiffies，与 pidstat 计算方式一致
+		itv := float64(total-lastTotal) / float64(cpuNum)
+		lastTotal = total
+
+		curTimes := m.sampleCPUTimes()
+		for pid, cur := range curTimes {
+			last, ok := lastTimes[pid]
+			if !ok || itv <= 0 {
+				continue
+			}
+			stats := cur.stats
+			computeCPUUsage(&stats, last.times, cur.times, itv)
+			stats.Timestamp = now
+			publishCPU(stats)
+		}
+		lastTimes = curTimes
+		return nil
+	})
+}
+
+// cpuSample 单个进程的一次采样
+type cpuSample struct {
+	stats ProcessCPUStats
+	times procCPUTimes
+}
+
+// sampleCPUTimes 采集所有目标进程的 CPU 累计时间
+func (m *CPUMonitor) sampleCPUTimes() map[int]cpuSample {
+	samples := make(map[int]cpuSample)
+	procs, err := listProcs(m.matcher)
+	if err != nil {
+		log.Printf("CPUMonitor list procs ,err : %v", err)
+		return samples
+	}
+	for _, p := range procs {
+		times, err := readCPUTimes(p.pid)
+		if err != nil {
+			continue
+		}
+		samples[p.pid] = cpuSample{
+			stats: ProcessCPUStats{
+				IP:      conf.Sc.IP,
+				PID:     p.pid,
+				User:    p.user,
+				Command: p.comm,
+			},
+			times: times,
+		}
+	}
+	return samples
+}
+
+// computeCPUUsage 根据两次采样的差值填充 CPU 使用率
+func computeCPUUsage(stats *ProcessCPUStats, last, cur procCPUTimes, itv float64) {
+	delta := func(cur, last uint64) float64 {
+		if cur < last {
+			return 0
+		}
+		return float64(cur - last)
+	}
+	utime := delta(cur.utime, last.utime)
+	stime := delta(cur.stime, last.stime)
+	guest := delta(cur.guestTime, last.guestTime)
+	usr := utime - guest
+	if usr < 0 {
+		usr = 0
+	}
+
+	stats.USR = usr / itv * 100
+	stats.System = stime / itv * 100
+	stats.Guest = guest / itv * 100
+	stats.Wait = delta(cur.waitNS, last.waitNS) / (itv * 1e9 / clockTicksPerSecond) * 100
+	stats.Total = (utime + stime) / itv * 100
+}
+
+// readCPUTimes 读取 /proc/[pid]/stat 与 /proc/[pid]/schedstat
+func readCPUTimes(pid int) (procCPUTimes, error) {
+	fields, err := readProcStat(pid)
+	if err != nil {
+		return procCPUTimes{}, err
+	}
+	// 下标相对于 state 字段：utime=11 stime=12 guest_time=40
+	if len(fields) < 41 {
+		return procCPUTimes{}, fmt.Errorf("invalid stat fields for pid %d", pid)
+	}
+	var times procCPUTimes
+	if times.utime, err = strconv.ParseUint(fields[11], 10, 64); err != nil {
+		return procCPUTimes{}, fmt.Errorf("error parsing utime: %v", err)
+	}
+	if times.stime, err = strconv.ParseUint(fields[12], 10, 64); err != nil {
+		return procCPUTimes{}, fmt.Errorf("error parsing stime: %v", err)
+	}
+	if times.guestTime, err = strconv.ParseUint(fields[40], 10, 64); err != nil {
+		return procCPUTimes{}, fmt.Errorf("error parsing guest_time: %v", err)
+	}
+
+	// schedstat 需要内核开启 CONFIG_SCHED_INFO，缺失时 wait 记为 0
+	if b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "schedstat")); err == nil {
+		if sf := strings.Fields(string(b)); len(sf) >= 2 {
+			times.waitNS, _ = strconv.ParseUint(sf[1], 10, 64)
+		}
+	}
+	return times, nil
+}
+
+// readTotalJiffies 读取 /proc/stat 中 cpu 总行的 jiffies 之和以及 CPU 个数
+func readTotalJiffies() (uint64, int, error) {
+	f, err := os.Open(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("error opening /proc/stat: %v", err)
+	}
+	defer f.Close()
+
+	var total uint64
+	cpuNum := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			cpuNum++
+			continue
+		}
+		// guest/guest_nice 已计入 user/nice，不重复累加
+		for i, v := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("error parsing /proc/stat: %v", err)
+			}
+			total += n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	if cpuNum == 0 {
+		cpuNum = 1
+	}
+	return total, cpuNum, nil
+}
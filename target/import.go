@@ -0,0 +1,172 @@
+package target
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"moniter/async"
+	"moniter/matcher"
+	"moniter/model"
+	"moniter/sink"
+	"os"
+	"time"
+)
+
+// ImportFiles 导入保存的 pidstat 文本输出（-u/-r/-d 任意组合）或 file 输出写出的 JSONL/CSV 文件，通过异步任务写入输出；
+// 返回时数据只是进入了异步任务，需在 async.ShutDown 之后用 ImportFailures 检查是否都已写入
+func ImportFiles(m *matcher.Matcher, paths []string) error {
+	initCPUStorage()
+	initMemoryStorage()
+	initIOStorage()
+	// 导入不允许丢数据，输出写不过来时等待
+	cpuTask().SetWaitConsumers(true)
+	memoryTask().SetWaitConsumers(true)
+	ioTask().SetWaitConsumers(true)
+
+	for _, path := range paths {
+		importer := importFile
+		if sink.IsDataFile(path) {
+			importer = importDataFile
+		}
+		n, err := importer(m, path)
+		if err != nil {
+			return fmt.Errorf("error importing %s: %v", path, err)
+		}
+		log.Printf("queued %d rows from %s", n, path)
+	}
+	return nil
+}
+
+// ImportFailures 导入的数据中写入失败或被丢弃的条数，按任务汇总为错误，全部写入成功时返回 nil；
+// 在 async.ShutDown 之后调用
+func ImportFailures() error {
+	var errs []error
+	for _, stats := range []async.Stats{cpuTask().Stats(), memoryTask().Stats(), ioTask().Stats()} {
+		if stats.Failed > 0 || stats.Dropped > 0 || stats.Errors > 0 {
+			errs = append(errs, fmt.Errorf("%s: %d rows written, %d rows failed, %d rows dropped, %d errors",
+				stats.Name, stats.Flushed, stats.Failed, stats.Dropped, stats.Errors))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// importFile 逐行解析单个文件，返回导入的行数
+func importFile(m *matcher.Matcher, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	stream := &pidstatStream{}
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		header, ts, ok, err := stream.parseLine(line)
+		if err != nil {
+			log.Printf("Error parsing time of line '%s': %v", line, err)
+			continue
+		}
+		if !ok || !isTargetLine(m, header, line) {
+			continue
+		}
+		n, err := publishLine(header, line, ts)
+		if err != nil {
+			log.Printf("Error parsing line '%s': %v", line, err)
+			continue
+		}
+		count += n
+	}
+	return count, scanner.Err()
+}
+
+// importDataFile 导入 file 输出写出的文件，返回导入的行数
+func importDataFile(m *matcher.Matcher, path string) (int, error) {
+	count := 0
+	err := sink.ReadFile(path, func(metric model.Metric) error {
+		// 任务状态与进程无关，不按匹配规则过滤，数量很少，直接写入输出
+		if stats, ok := metric.(model.TaskStats); ok {
+			count++
+			return sink.Write([]model.TaskStats{stats})
+		}
+		tags := metric.Tags()
+		if !m.Empty() && !m.MatchOffline(offlineProcess(tags.PID, tags.User, tags.Command)) {
+			return nil
+		}
+		var err error
+		switch stats := metric.(type) {
+		case ProcessCPUStats:
+			err = cpuTask().PubWait(stats)
+		case ProcessMemStats:
+			err = memoryTask().PubWait(stats)
+		case ProcessIOStats:
+			err = ioTask().PubWait(stats)
+		}
+		if err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// isTargetLine 按匹配规则判断是否为目标进程，只能使用 pidstat 输出中的信息；未配置规则时全部导入
+func isTargetLine(m *matcher.Matcher, h *pidstatHeader, line string) bool {
+	if m.Empty() {
+		return true
+	}
+	row, err := newPidstatRow(h, line)
+	if err != nil {
+		return false
+	}
+	pid, err := row.pid()
+	if err != nil {
+		return false
+	}
+	return m.MatchOffline(offlineProcess(pid, row.str("UID"), row.command()))
+}
+
+// offlineProcess 由 Command 列构造待匹配的进程：Command 列作为命令行供 cmdline_regex 匹配，
+// -l 模式下的完整命令行取 argv[0] 的文件名作为进程名供 comm、comm_regex 匹配
+func offlineProcess(pid int, user, command string) matcher.Process {
+	return matcher.Process{PID: pid, Comm: commandComm(command), User: user, Cmdline: command}
+}
+
+// publishLine 按列头解析一行数据并推入对应的异步任务，-h 模式下一行可能同时包含 CPU、内存、IO
+func publishLine(h *pidstatHeader, line string, ts time.Time) (int, error) {
+	n := 0
+	if h.cpu {
+		stats, err := parseCPUStats(h, ts, line)
+		if err != nil {
+			return n, err
+		}
+		if err = cpuTask().PubWait(stats); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if h.memory {
+		stats, err := parseMemoryStats(h, ts, line)
+		if err != nil {
+			return n, err
+		}
+		if err = memoryTask().PubWait(stats); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if h.io {
+		stats, err := parseIOStats(h, ts, line)
+		if err != nil {
+			return n, err
+		}
+		if err = ioTask().PubWait(stats); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
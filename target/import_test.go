@@ -0,0 +1,61 @@
+package target
+
+import (
+	"moniter/conf"
+	"moniter/matcher"
+	"testing"
+)
+
+func TestCommandComm(t *testing.T) {
+	cases := []struct {
+		command string
+		want    string
+	}{
+		{"mysqld", "mysqld"},
+		{"kworker/0:1", "kworker/0:1"},
+		{"/usr/sbin/mysqld --defaults-file=/etc/my.cnf", "mysqld"},
+		{"/usr/sbin/mysqld", "mysqld"},
+		{"nginx: worker process", "nginx:"},
+		{"/opt/app/bin/very-long-process-name --flag", "very-long-proce"},
+	}
+	for _, c := range cases {
+		if got := commandComm(c.command); got != c.want {
+			t.Errorf("commandComm(%q) = %q, want %q", c.command, got, c.want)
+		}
+	}
+}
+
+func TestIsTargetLine(t *testing.T) {
+	const header = "10:00:01      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command"
+	h := parsePidstatHeader(header)
+	if h == nil {
+		t.Fatalf("parse header %q failed", header)
+	}
+	short := "10:00:02      999      1234   12.00    3.00    0.00    0.50   15.00     1  mysqld"
+	long := "10:00:02      999      1234   12.00    3.00    0.00    0.50   15.00     1  /usr/sbin/mysqld --defaults-file=/etc/my.cnf"
+	other := "10:00:02        0         1    0.00    1.00    0.00    0.00    1.00     0  /sbin/init splash"
+
+	cases := []struct {
+		name string
+		rule conf.ProcessRule
+		line string
+		want bool
+	}{
+		{"comm", conf.ProcessRule{Comm: "mysqld"}, short, true},
+		{"comm -l", conf.ProcessRule{Comm: "mysqld"}, long, true},
+		{"comm -l other", conf.ProcessRule{Comm: "mysqld"}, other, false},
+		{"comm_regex -l", conf.ProcessRule{CommRegex: "^mysql"}, long, true},
+		{"cmdline_regex", conf.ProcessRule{CmdlineRegex: "mysqld"}, short, true},
+		{"cmdline_regex -l", conf.ProcessRule{CmdlineRegex: "--defaults-file=/etc/my.cnf"}, long, true},
+		{"cmdline_regex -l other", conf.ProcessRule{CmdlineRegex: "--defaults-file"}, other, false},
+	}
+	for _, c := range cases {
+		m, err := matcher.New([]conf.ProcessRule{c.rule})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := isTargetLine(m, h, c.line); got != c.want {
+			t.Errorf("%s: isTargetLine(%q) = %v, want %v", c.name, c.line, got, c.want)
+		}
+	}
+}
@@ -1,166 +1,125 @@
 package target
 
 import (
-	"bufio"
-	"fmt"
+	"context"
 	"log"
-	"mon/async"
-	"mon/conf"
-	"mon/db"
-	"os/exec"
+	"moniter/async"
+	"moniter/conf"
+	"moniter/matcher"
+	"moniter/model"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
-// ProcessIOStats 存储进程 IO 统计信息
-type ProcessIOStats struct {
-	ID        uint      `gorm:"primaryKey"`    // 主键
-	Timestamp time.Time `gorm:"type:datetime"` // 时间戳
-	IP        string    `gorm:"type:varchar(50);not null"`
-	PID       int       `gorm:"column:pid;not null"`        // 进程 ID
-	User      string    `gorm:"column:user;not null"`       // 用户名
-	ReadKBPS  float64   `gorm:"column:read_kbps;not null"`  // 每秒读取 KB
-	WriteKBPS float64   `gorm:"column:write_kbps;not null"` // 每秒写入 KB
-	KBCCWR    float64   `gorm:"column:kbccwr;not null"`     // 每秒读取操作次数
-	IODelay   float64   `gorm:"column:io_delay;not null"`   // 每秒写入操作次数
-	Command   string    `gorm:"column:command;not null"`    // 命令
-}
+// ProcessIOStats 见 model.ProcessIOStats
+type ProcessIOStats = model.ProcessIOStats
 
 // IOMonitor IO 监控器
 type IOMonitor struct {
-	processes []string // 要监控的进程名列表
-	interval  int      // 监控间隔（秒）
+	matcher  *matcher.Matcher // 要监控的进程匹配规则
+	interval int              // 监控间隔（秒）
+	backend  string           // 采集方式：pidstat 或 proc
+}
+
+// ioStorageOnce 保证异步任务只初始化一次
+var ioStorageOnce sync.Once
+
+func init() {
+	Register("io", func(cfg CollectorConfig) (Collector, error) {
+		var opts backendOptions
+		if err := decodeOptions(cfg.Options, &opts); err != nil {
+			return nil, err
+		}
+		return NewIOMonitor(cfg.Matcher, cfg.Interval, opts.Backend), nil
+	})
 }
 
 // NewIOMonitor 创建新的 IO 监控器
-func NewIOMonitor(processes []string, interval int) *IOMonitor {
-	db.DBConn.AutoMigrate(&ProcessIOStats{})
-	ioTask := async.IOTask()
-	ioTask.SetConsumer(BatchCreateIO)
-	ioTask.Async()
+func NewIOMonitor(m *matcher.Matcher, interval int, backend string) *IOMonitor {
+	initIOStorage()
 	return &IOMonitor{
-		processes: processes,
-		interval:  interval,
+		matcher:  m,
+		interval: interval,
+		backend:  backend,
 	}
 }
 
-// StartMonitoring 开始监控进程 IO 使用情况
-func (m *IOMonitor) StartMonitoring() error {
-	// 构建 pidstat 命令
-	cmd := exec.Command("pidstat", "-d", strconv.Itoa(m.interval))
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("error creating stdout pipe: %v", err)
-	}
-
-	// 启动命令
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("error starting pidstat: %v", err)
-	}
+// initIOStorage 启动 IO 异步写入任务，可重复调用
+func initIOStorage() {
+	ioStorageOnce.Do(func() {
+		task := ioTask()
+		addSinkConsumers(task)
+		task.Async()
+	})
+}
 
-	// 创建 scanner 读取输出
-	scanner := bufio.NewScanner(stdout)
+// ioTask IO 异步写入任务
+func ioTask() *async.Task[ProcessIOStats] {
+	return async.GetTask[ProcessIOStats]("io")
+}
 
-	// 跳过头部信息
-	for i := 0; i < 3; i++ {
-		scanner.Scan()
+// StartMonitoring 开始监控进程 IO 使用情况
+func (m *IOMonitor) StartMonitoring(ctx context.Context) error {
+	if m.backend == BackendProc {
+		return m.startProcMonitoring(ctx)
 	}
+	return m.startPidstatMonitoring(ctx)
+}
 
-	//// 打印表头
-	//fmt.Printf("%-20s %-8s %-10s %-10s %-10s %-10s %-10s %s\n",
-	//	"Timestamp", "PID", "User", "kB_rd/s", "kB_wr/s", "kB_ccwr/s", "iodelay", "Command")
-	//fmt.Println(strings.Repeat("-", 100))
-
-	// 处理每一行输出
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.TrimSpace(line) == "" {
-			continue
+// startPidstatMonitoring 通过 pidstat -d 采集进程 IO 使用情况
+func (m *IOMonitor) startPidstatMonitoring(ctx context.Context) error {
+	return runPidstat(ctx, []string{"-d", strconv.Itoa(m.interval)}, func(h *pidstatHeader, ts time.Time, line string) {
+		if !h.io {
+			return
 		}
-
-		// 检查是否是目标进程
-		isTargetProcess := false
-		for _, process := range m.processes {
-			if strings.Contains(line, process) {
-				isTargetProcess = true
-				break
-			}
+		stats, err := parseIOStats(h, ts, line)
+		if err != nil {
+			log.Printf("Error parsing line '%s': %v", line, err)
+			return
 		}
-
-		if isTargetProcess {
-			stats, err := parseIOStats(line)
-			if err != nil {
-				log.Printf("Error parsing line '%s': %v", line, err)
-				continue
-			}
-
-			if err = async.IOTask().Pub(stats); err != nil {
-				if err = db.DBConn.Create(&stats).Error; err != nil {
-					log.Printf("IOMonitor Create ,err : %v", err)
-					continue
-				}
-			}
+		// 检查是否是目标进程
+		if !m.matcher.Match(matcher.Process{PID: stats.PID, Comm: stats.Command, User: stats.User}) {
+			return
 		}
-	}
-
-	return cmd.Wait()
+		publishIO(stats)
+	})
 }
 
-func BatchCreateIO(data []interface{}) {
-	ioData := make([]ProcessIOStats, len(data))
-	for i, i2 := range data {
-		ioData[i] = i2.(ProcessIOStats)
-	}
-	if err := db.DBConn.CreateInBatches(ioData, 1000).Error; err != nil {
-		log.Printf("IOMonitor CreateInBatches ,err : %v", err)
-	}
+// publishIO 推入异步任务，channel 已满时按任务的 overflow 策略处理，丢弃的数据由任务计数
+func publishIO(stats ProcessIOStats) {
+	ioTask().Pub(stats)
 }
 
-// parseIOStats 解析 pidstat 输出行
-func parseIOStats(line string) (ProcessIOStats, error) {
-	fields := strings.Fields(line)
-	if len(fields) < 8 {
-		return ProcessIOStats{}, fmt.Errorf("invalid line format: %s", line)
-	}
-
-	// 解析 PID
-	pid, err := strconv.Atoi(fields[2])
-	if err != nil {
-		return ProcessIOStats{}, fmt.Errorf("error parsing PID: %v", err)
-	}
-
-	// 解析 IO 数据
-	readKB, err := strconv.ParseFloat(fields[4], 64)
+// parseIOStats 按列头解析 pidstat 输出行
+func parseIOStats(h *pidstatHeader, ts time.Time, line string) (ProcessIOStats, error) {
+	row, err := newPidstatRow(h, line)
 	if err != nil {
-		return ProcessIOStats{}, fmt.Errorf("error parsing kB_rd/s: %v", err)
+		return ProcessIOStats{}, err
 	}
 
-	writeKB, err := strconv.ParseFloat(fields[5], 64)
-	if err != nil {
-		return ProcessIOStats{}, fmt.Errorf("error parsing kB_wr/s: %v", err)
-	}
-
-	kB_ccwr, err := strconv.ParseFloat(fields[6], 64)
+	// 解析 PID
+	pid, err := row.pid()
 	if err != nil {
-		return ProcessIOStats{}, fmt.Errorf("error parsing IO_rd/s: %v", err)
+		return ProcessIOStats{}, err
 	}
 
-	ioDelay, err := strconv.ParseFloat(fields[7], 64)
+	// 解析 IO 数据，旧版本 sysstat 没有 kB_ccwr/s、iodelay 列
+	values, err := row.floats("kB_rd/s", "kB_wr/s", "kB_ccwr/s", "iodelay")
 	if err != nil {
-		return ProcessIOStats{}, fmt.Errorf("error parsing IO_wr/s: %v,fields:%v", err, fields[7])
+		return ProcessIOStats{}, err
 	}
 
 	return ProcessIOStats{
 		IP:        conf.Sc.IP,
 		PID:       pid,
-		User:      fields[3],
-		ReadKBPS:  readKB,
-		WriteKBPS: writeKB,
-		KBCCWR:    kB_ccwr,
-		IODelay:   ioDelay,
-		Command:   fields[len(fields)-1],
-		Timestamp: time.Now(),
+		User:      row.str("UID"),
+		ReadKBPS:  values[0],
+		WriteKBPS: values[1],
+		KBCCWR:    values[2],
+		IODelay:   values[3],
+		Command:   row.command(),
+		Timestamp: ts,
 	}, nil
 }
 
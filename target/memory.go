@@ -1,167 +1,125 @@
 package target
 
 import (
-	"bufio"
-	"fmt"
+	"context"
 	"log"
-	"mon/async"
-	"mon/conf"
-	"mon/db"
-	"os/exec"
+	"moniter/async"
+	"moniter/conf"
+	"moniter/matcher"
+	"moniter/model"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
-// ProcessMemStats 存储进程内存统计信息
-type ProcessMemStats struct {
-	ID          uint      `gorm:"primaryKey"` // 主键
-	IP          string    `gorm:"type:varchar(50);not null"`
-	Timestamp   time.Time `gorm:"type:datetime"`                // 时间戳
-	PID         int       `gorm:"column:pid;not null"`          // 进程 ID
-	User        string    `gorm:"column:user;not null"`         // 用户名
-	MinorFaults float64   `gorm:"column:minor_faults;not null"` // 次缺页错误
-	MajorFaults float64   `gorm:"column:major_faults;not null"` // 主缺页错误
-	VSZ         float64   `gorm:"column:vsz;not null"`          // 虚拟内存大小 (KB)
-	RSS         float64   `gorm:"column:rss;not null"`          // 物理内存大小 (KB)
-	Command     string    `gorm:"column:command;not null"`      // 命令
-}
+// ProcessMemStats 见 model.ProcessMemStats
+type ProcessMemStats = model.ProcessMemStats
 
 // MemoryMonitor 内存监控器
 type MemoryMonitor struct {
-	processes []string  // 要监控的进程名列表
-	interval  int       // 监控间隔（秒）
-	stopChan  chan bool // 用于停止监控的通道
+	matcher  *matcher.Matcher // 要监控的进程匹配规则
+	interval int              // 监控间隔（秒）
+	backend  string           // 采集方式：pidstat 或 proc
+}
+
+// memoryStorageOnce 保证异步任务只初始化一次
+var memoryStorageOnce sync.Once
+
+func init() {
+	Register("memory", func(cfg CollectorConfig) (Collector, error) {
+		var opts backendOptions
+		if err := decodeOptions(cfg.Options, &opts); err != nil {
+			return nil, err
+		}
+		return NewMemoryMonitor(cfg.Matcher, cfg.Interval, opts.Backend), nil
+	})
 }
 
 // NewMemoryMonitor 创建新的内存监控器
-func NewMemoryMonitor(processes []string, interval int) *MemoryMonitor {
-	db.DBConn.AutoMigrate(&ProcessMemStats{})
-	memoryTask := async.MemoryTask()
-	memoryTask.SetConsumer(BatchCreateMemory)
-	memoryTask.Async()
+func NewMemoryMonitor(m *matcher.Matcher, interval int, backend string) *MemoryMonitor {
+	initMemoryStorage()
 	return &MemoryMonitor{
-		processes: processes,
-		interval:  interval,
-		stopChan:  make(chan bool),
+		matcher:  m,
+		interval: interval,
+		backend:  backend,
 	}
 }
 
-// StartMonitoring 开始监控进程内存使用情况
-func (m *MemoryMonitor) StartMonitoring() error {
-	// 构建命令和管道
-	cmd := exec.Command("pidstat", "-r", strconv.Itoa(m.interval))
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("error creating stdout pipe: %v", err)
-	}
-
-	// 启动命令
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("error starting pidstat: %v", err)
-	}
+// initMemoryStorage 启动内存异步写入任务，可重复调用
+func initMemoryStorage() {
+	memoryStorageOnce.Do(func() {
+		task := memoryTask()
+		addSinkConsumers(task)
+		task.Async()
+	})
+}
 
-	// 创建scanner读取输出
-	scanner := bufio.NewScanner(stdout)
+// memoryTask 内存异步写入任务
+func memoryTask() *async.Task[ProcessMemStats] {
+	return async.GetTask[ProcessMemStats]("memory")
+}
 
-	// 跳过头部信息
-	for i := 0; i < 3; i++ {
-		scanner.Scan()
+// StartMonitoring 开始监控进程内存使用情况
+func (m *MemoryMonitor) StartMonitoring(ctx context.Context) error {
+	if m.backend == BackendProc {
+		return m.startProcMonitoring(ctx)
 	}
+	return m.startPidstatMonitoring(ctx)
+}
 
-	//// 处理每一行输出
-	//fmt.Printf("%-20s %-8s %-10s %-10s %-10s %-10s %-10s %s\n",
-	//	"Timestamp", "PID", "User", "MinFlt/s", "MajFlt/s", "VSZ(KB)", "RSS(KB)", "Command")
-	//fmt.Println(strings.Repeat("-", 100))
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.TrimSpace(line) == "" {
-			continue
+// startPidstatMonitoring 通过 pidstat -r 采集进程内存使用情况
+func (m *MemoryMonitor) startPidstatMonitoring(ctx context.Context) error {
+	return runPidstat(ctx, []string{"-r", strconv.Itoa(m.interval)}, func(h *pidstatHeader, ts time.Time, line string) {
+		if !h.memory {
+			return
 		}
-
-		// 检查是否是我们要监控的进程
-		isTargetProcess := false
-		for _, process := range m.processes {
-			if strings.Contains(line, process) {
-				isTargetProcess = true
-				break
-			}
+		stats, err := parseMemoryStats(h, ts, line)
+		if err != nil {
+			log.Printf("Error parsing line '%s': %v", line, err)
+			return
 		}
-
-		if isTargetProcess {
-			stats, err := parseMemoryStats(line)
-			if err != nil {
-				log.Printf("Error parsing line '%s': %v", line, err)
-				continue
-			}
-			if err = async.MemoryTask().Pub(stats); err != nil {
-				if err = db.DBConn.Create(&stats).Error; err != nil {
-					log.Printf("MemoryMonitor Create ,err : %v", err)
-					continue
-				}
-			}
-
+		// 检查是否是目标进程
+		if !m.matcher.Match(matcher.Process{PID: stats.PID, Comm: stats.Command, User: stats.User}) {
+			return
 		}
-	}
-
-	return cmd.Wait()
+		publishMemory(stats)
+	})
 }
 
-func BatchCreateMemory(data []interface{}) {
-	memoryData := make([]ProcessMemStats, len(data))
-	for i, i2 := range data {
-		memoryData[i] = i2.(ProcessMemStats)
-	}
-	if err := db.DBConn.CreateInBatches(memoryData, 1000).Error; err != nil {
-		log.Printf("IOMonitor CreateInBatches ,err : %v", err)
-	}
+// publishMemory 推入异步任务，channel 已满时按任务的 overflow 策略处理，丢弃的数据由任务计数
+func publishMemory(stats ProcessMemStats) {
+	memoryTask().Pub(stats)
 }
 
-// parseMemoryStats 解析pidstat输出行
-func parseMemoryStats(line string) (ProcessMemStats, error) {
-	fields := strings.Fields(line)
-	if len(fields) < 8 {
-		return ProcessMemStats{}, fmt.Errorf("invalid line format: %s", line)
+// parseMemoryStats 按列头解析pidstat输出行
+func parseMemoryStats(h *pidstatHeader, ts time.Time, line string) (ProcessMemStats, error) {
+	row, err := newPidstatRow(h, line)
+	if err != nil {
+		return ProcessMemStats{}, err
 	}
 
 	// 解析PID
-	pid, err := strconv.Atoi(fields[2])
+	pid, err := row.pid()
 	if err != nil {
-		return ProcessMemStats{}, fmt.Errorf("error parsing PID: %v", err)
+		return ProcessMemStats{}, err
 	}
 
 	// 解析其他数值字段
-	minFaults, err := strconv.ParseFloat(fields[5], 64)
-	if err != nil {
-		return ProcessMemStats{}, fmt.Errorf("error parsing minor faults: %v", err)
-	}
-
-	majFaults, err := strconv.ParseFloat(fields[6], 64)
-	if err != nil {
-		return ProcessMemStats{}, fmt.Errorf("error parsing major faults: %v", err)
-	}
-
-	vsz, err := strconv.ParseFloat(fields[7], 64)
-	if err != nil {
-		return ProcessMemStats{}, fmt.Errorf("error parsing VSZ: %v", err)
-	}
-
-	rss, err := strconv.ParseFloat(fields[8], 64)
+	values, err := row.floats("minflt/s", "majflt/s", "VSZ", "RSS")
 	if err != nil {
-		return ProcessMemStats{}, fmt.Errorf("error parsing RSS: %v", err)
+		return ProcessMemStats{}, err
 	}
 
 	return ProcessMemStats{
 		IP:          conf.Sc.IP,
 		PID:         pid,
-		User:        fields[3],
-		MinorFaults: minFaults,
-		MajorFaults: majFaults,
-		VSZ:         vsz,
-		RSS:         rss,
-		Command:     fields[len(fields)-1],
-		Timestamp:   time.Now(),
+		User:        row.str("UID"),
+		MinorFaults: values[0],
+		MajorFaults: values[1],
+		VSZ:         values[2],
+		RSS:         values[3],
+		Command:     row.command(),
+		Timestamp:   ts,
 	}, nil
 }
 
@@ -0,0 +1,153 @@
+package target
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"moniter/conf"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memSample 单个进程的一次采样
+type memSample struct {
+	stats       ProcessMemStats
+	minorFaults uint64 // 累计次缺页次数
+	majorFaults uint64 // 累计主缺页次数
+}
+
+// startProcMonitoring 基于 /proc/[pid]/smaps_rollup 与 /proc/[pid]/status 采集内存明细
+func (m *MemoryMonitor) startProcMonitoring(ctx context.Context) error {
+	lastTime := time.Now()
+	lastSamples := m.sampleMemory()
+
+	return runTicker(ctx, m.interval, func(now time.Time) error {
+		elapsed := now.Sub(lastTime).Seconds()
+		lastTime = now
+
+		curSamples := m.sampleMemory()
+		for pid, cur := range curSamples {
+			last, ok := lastSamples[pid]
+			if !ok || elapsed <= 0 {
+				continue
+			}
+			stats := cur.stats
+			if cur.minorFaults >= last.minorFaults {
+				stats.MinorFaults = float64(cur.minorFaults-last.minorFaults) / elapsed
+			}
+			if cur.majorFaults >= last.majorFaults {
+				stats.MajorFaults = float64(cur.majorFaults-last.majorFaults) / elapsed
+			}
+			stats.Timestamp = now
+			publishMemory(stats)
+		}
+		lastSamples = curSamples
+		return nil
+	})
+}
+
+// sampleMemory 采集所有目标进程的内存明细
+func (m *MemoryMonitor) sampleMemory() map[int]memSample {
+	samples := make(map[int]memSample)
+	procs, err := listProcs(m.matcher)
+	if err != nil {
+		log.Printf("MemoryMonitor list procs ,err : %v", err)
+		return samples
+	}
+	for _, p := range procs {
+		sample, err := readMemSample(p.pid)
+		if err != nil {
+			continue
+		}
+		sample.stats.IP = conf.Sc.IP
+		sample.stats.PID = p.pid
+		sample.stats.User = p.user
+		sample.stats.Command = p.comm
+		samples[p.pid] = sample
+	}
+	return samples
+}
+
+// readMemSample 读取单个进程的内存明细与缺页计数
+func readMemSample(pid int) (memSample, error) {
+	status, err := readProcStatus(pid)
+	if err != nil {
+		return memSample{}, err
+	}
+	// 内核线程没有用户态地址空间
+	if _, ok := status["VmSize"]; !ok {
+		return memSample{}, fmt.Errorf("pid %d has no user memory", pid)
+	}
+
+	var sample memSample
+	stats := &sample.stats
+	stats.VSZ = parseKB(status["VmSize"])
+	stats.RSS = parseKB(status["VmRSS"])
+	stats.RssAnon = parseKB(status["RssAnon"])
+	stats.RssFile = parseKB(status["RssFile"])
+	stats.RssShmem = parseKB(status["RssShmem"])
+	stats.HugetlbPages = parseKB(status["HugetlbPages"])
+	stats.Swap = parseKB(status["VmSwap"])
+
+	// smaps_rollup 需要读取其他用户进程的权限，读不到时只保留 status 中的数据
+	if smaps, err := readSmapsRollup(pid); err == nil {
+		stats.PSS = smaps["Pss"]
+		stats.USS = smaps["Private_Clean"] + smaps["Private_Dirty"] + smaps["Private_Hugetlb"]
+		stats.AnonHugePages = smaps["AnonHugePages"]
+		if swap, ok := smaps["Swap"]; ok {
+			stats.Swap = swap
+		}
+	}
+
+	// 下标相对于 state 字段：minflt=7 majflt=9
+	fields, err := readProcStat(pid)
+	if err != nil {
+		return memSample{}, err
+	}
+	if len(fields) > 9 {
+		sample.minorFaults, _ = strconv.ParseUint(fields[7], 10, 64)
+		sample.majorFaults, _ = strconv.ParseUint(fields[9], 10, 64)
+	}
+	return sample, nil
+}
+
+// readSmapsRollup 读取 /proc/[pid]/smaps_rollup，旧内核（< 4.14）退回到逐段累加 smaps
+func readSmapsRollup(pid int) (map[string]float64, error) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	f, err := os.Open(filepath.Join(dir, "smaps_rollup"))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(dir, "smaps"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	smaps := make(map[string]float64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || !strings.HasSuffix(value, "kB") {
+			continue
+		}
+		smaps[key] += parseKB(value)
+	}
+	return smaps, scanner.Err()
+}
+
+// parseKB 解析形如 "1234 kB" 的值
+func parseKB(value string) float64 {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	kb, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return kb
+}
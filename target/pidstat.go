@@ -0,0 +1,259 @@
+package target
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commLen 内核中 comm 的最大长度，pidstat 不带 -l 时 Command 列就是 comm
+const commLen = 15
+
+// columnAliases 不同 sysstat 版本的列名统一为同一个名称
+var columnAliases = map[string]string{
+	"%user": "%usr", // sysstat < 10.0
+	"USER":  "UID",  // pidstat -U
+	"TGID":  "PID",  // pidstat -t
+}
+
+// meridiems 12 小时制 locale 下时间后面的 AM/PM 字段
+var meridiems = map[string]string{
+	"AM": "AM", "PM": "PM",
+	"am": "AM", "pm": "PM",
+	"上午": "AM", "下午": "PM",
+}
+
+// bannerDateLayouts pidstat 首行日期在不同 locale 下的格式
+var bannerDateLayouts = []string{"2006-01-02", "01/02/2006", "01/02/06", "02/01/2006", "02.01.2006"}
+
+// pidstatEnv 固定 24 小时制时间与 ISO 日期，避免不同 locale 下输出格式不同
+var pidstatEnv = []string{"LC_ALL=C", "S_TIME_FORMAT=ISO"}
+
+// pidstatHeader pidstat 列头，记录列名到下标的映射（下标不含时间字段）
+type pidstatHeader struct {
+	columns map[string]int
+	cpu     bool // 含 -u 的列
+	memory  bool // 含 -r 的列
+	io      bool // 含 -d 的列
+}
+
+// parsePidstatHeader 解析列头行，不是列头时返回 nil
+//
+//	10:00:01 AM   UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+//	# Time        UID       PID    %usr ...                                     (-h)
+//	1732521601    UID       PID    %usr ...                                     (-H)
+func parsePidstatHeader(line string) *pidstatHeader {
+	fields := strings.Fields(line)
+	if len(fields) > 0 && fields[0] == "#" {
+		fields = fields[1:]
+	}
+	_, names := splitTime(fields)
+
+	h := &pidstatHeader{columns: make(map[string]int, len(names))}
+	for i, name := range names {
+		if alias, ok := columnAliases[name]; ok {
+			name = alias
+		}
+		h.columns[name] = i
+	}
+	if _, ok := h.columns["PID"]; !ok {
+		return nil
+	}
+	if _, ok := h.columns["Command"]; !ok {
+		return nil
+	}
+	_, h.cpu = h.columns["%usr"]
+	_, h.memory = h.columns["minflt/s"]
+	_, h.io = h.columns["kB_rd/s"]
+	return h
+}
+
+// pidstatRow 按列头拆分后的一行数据
+type pidstatRow struct {
+	header *pidstatHeader
+	clock  []string // 时间字段
+	values []string // 其余各列
+}
+
+// newPidstatRow 拆分数据行，字段数少于列头时返回错误
+func newPidstatRow(h *pidstatHeader, line string) (*pidstatRow, error) {
+	clock, values := splitTime(strings.Fields(line))
+	if len(clock) == 0 || len(values) < len(h.columns) {
+		return nil, fmt.Errorf("invalid line format: %s", line)
+	}
+	return &pidstatRow{header: h, clock: clock, values: values}, nil
+}
+
+// str 取字符串列，不存在时返回空
+func (r *pidstatRow) str(name string) string {
+	idx, ok := r.header.columns[name]
+	if !ok {
+		return ""
+	}
+	return r.values[idx]
+}
+
+// float 取数值列，旧版本 sysstat 中不存在的列记为 0
+func (r *pidstatRow) float(name string) (float64, error) {
+	idx, ok := r.header.columns[name]
+	if !ok {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(r.values[idx], 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %v", name, err)
+	}
+	return v, nil
+}
+
+// pid 取 PID 列
+func (r *pidstatRow) pid() (int, error) {
+	pid, err := strconv.Atoi(r.str("PID"))
+	if err != nil {
+		return 0, fmt.Errorf("error parsing PID: %v", err)
+	}
+	return pid, nil
+}
+
+// command 取 Command 列，-l 模式下命令行中可能含空格
+func (r *pidstatRow) command() string {
+	return strings.Join(r.values[r.header.columns["Command"]:], " ")
+}
+
+// commandComm 由 Command 列得到进程名：含空格、以 / 开头或超过 comm 长度时是 -l 模式下的完整命令行，
+// 取 argv[0] 的文件名并与内核一样截断到 15 个字符；否则 Command 列就是 comm
+func commandComm(command string) string {
+	argv0, _, args := strings.Cut(command, " ")
+	if !args && len(argv0) <= commLen && !strings.HasPrefix(argv0, "/") {
+		return command
+	}
+	name := path.Base(argv0)
+	if len(name) > commLen {
+		name = name[:commLen]
+	}
+	return name
+}
+
+// floats 依次解析多个数值列
+func (r *pidstatRow) floats(names ...string) ([]float64, error) {
+	values := make([]float64, len(names))
+	for i, name := range names {
+		v, err := r.float(name)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// splitTime 拆出行首的时间字段：HH:MM:SS、HH:MM:SS AM/PM、epoch 秒或 -h 列头中的 Time
+func splitTime(fields []string) ([]string, []string) {
+	if len(fields) == 0 {
+		return nil, fields
+	}
+	n := 1
+	if len(fields) > 1 {
+		if _, ok := meridiems[fields[1]]; ok {
+			n = 2
+		}
+	}
+	return fields[:n], fields[n:]
+}
+
+// parseClock 解析时间字段，epoch 返回完整时间，否则只有时分秒（isClock 为 true）
+func parseClock(clock []string) (ts time.Time, isClock bool, err error) {
+	if len(clock) == 0 {
+		return time.Time{}, false, fmt.Errorf("missing time field")
+	}
+	if !strings.Contains(clock[0], ":") {
+		sec, err := strconv.ParseInt(clock[0], 10, 64)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("error parsing time: %v", err)
+		}
+		return time.Unix(sec, 0), false, nil
+	}
+	if len(clock) > 1 {
+		ts, err = time.Parse("03:04:05 PM", clock[0]+" "+meridiems[clock[1]])
+	} else {
+		ts, err = time.Parse("15:04:05", clock[0])
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("error parsing time: %v", err)
+	}
+	return ts, true, nil
+}
+
+// pidstatStream 一段 pidstat 输出（实时管道或保存的日志）的解析状态
+type pidstatStream struct {
+	date     time.Time      // 首行中的日期
+	lastTime time.Time      // 上一行的时间，用于识别跨天
+	header   *pidstatHeader // 当前段落的列头
+}
+
+// parseLine 处理一行输出，返回数据行所属的列头与 pidstat 报告的采样时间；
+// 首行、列头、空行、Average 行返回 ok 为 false
+func (p *pidstatStream) parseLine(line string) (header *pidstatHeader, ts time.Time, ok bool, err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "Average") {
+		return nil, time.Time{}, false, nil
+	}
+	if p.parseBanner(fields) {
+		return nil, time.Time{}, false, nil
+	}
+	if h := parsePidstatHeader(line); h != nil {
+		p.header = h
+		return nil, time.Time{}, false, nil
+	}
+	if p.header == nil {
+		return nil, time.Time{}, false, nil
+	}
+
+	clock, _ := splitTime(fields)
+	ts, err = p.lineTime(clock)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return p.header, ts, true, nil
+}
+
+// parseBanner 解析 "Linux 5.15.0 (host) 11/25/2024 _x86_64_ (8 CPU)" 首行中的日期
+func (p *pidstatStream) parseBanner(fields []string) bool {
+	if fields[0] != "Linux" {
+		return false
+	}
+	for _, field := range fields[1:] {
+		for _, layout := range bannerDateLayouts {
+			if date, err := time.ParseInLocation(layout, field, time.Local); err == nil {
+				p.date = date
+				p.lastTime = time.Time{}
+				p.header = nil
+				return true
+			}
+		}
+	}
+	return true
+}
+
+// lineTime 将行首的时间与首行日期合并为完整时间，-H 模式下直接使用 epoch 秒；
+// 同一采样周期的各行时间字段相同，因此得到的时间完全一致
+func (p *pidstatStream) lineTime(clock []string) (time.Time, error) {
+	t, isClock, err := parseClock(clock)
+	if err != nil || !isClock {
+		return t, err
+	}
+	if p.date.IsZero() {
+		return time.Time{}, fmt.Errorf("missing pidstat banner line")
+	}
+	ts := time.Date(p.date.Year(), p.date.Month(), p.date.Day(),
+		t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+	// 时间回退说明跨过了零点
+	if ts.Before(p.lastTime) {
+		p.date = p.date.AddDate(0, 0, 1)
+		ts = ts.AddDate(0, 0, 1)
+	}
+	p.lastTime = ts
+	return ts, nil
+}
@@ -0,0 +1,326 @@
+package target
+
+import (
+	"moniter/conf"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIP = "10.0.0.1"
+
+func TestMain(m *testing.M) {
+	conf.Sc = &conf.ServerConfig{IP: testIP}
+	os.Exit(m.Run())
+}
+
+// parseOutput 按行解析一段 pidstat 输出，返回解析出的各行数据与出错的行数
+func parseOutput(t *testing.T, output string) ([]interface{}, int) {
+	t.Helper()
+	stream := &pidstatStream{}
+	var rows []interface{}
+	bad := 0
+	for _, line := range strings.Split(output, "\n") {
+		header, ts, ok, err := stream.parseLine(line)
+		if err != nil {
+			bad++
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if header.cpu {
+			stats, err := parseCPUStats(header, ts, line)
+			if err != nil {
+				t.Fatalf("parse cpu %q: %v", line, err)
+			}
+			rows = append(rows, stats)
+		}
+		if header.memory {
+			stats, err := parseMemoryStats(header, ts, line)
+			if err != nil {
+				t.Fatalf("parse memory %q: %v", line, err)
+			}
+			rows = append(rows, stats)
+		}
+		if header.io {
+			stats, err := parseIOStats(header, ts, line)
+			if err != nil {
+				t.Fatalf("parse io %q: %v", line, err)
+			}
+			rows = append(rows, stats)
+		}
+	}
+	return rows, bad
+}
+
+// at 本地时间
+func at(year int, month time.Month, day, hour, min, sec int) time.Time {
+	return time.Date(year, month, day, hour, min, sec, 0, time.Local)
+}
+
+func TestPidstatStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []interface{}
+		bad    int
+	}{
+		{
+			name: "sysstat 12 -u LC_ALL=C S_TIME_FORMAT=ISO",
+			output: `Linux 5.15.0-91-generic (web01) 	2024-11-25 	_x86_64_	(8 CPU)
+
+10:00:01      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+10:00:02        0         1    0.00    1.00    0.00    0.00    1.00     3  systemd
+10:00:02      999      1234   12.00    3.00    0.00    0.50   15.00     1  mysqld
+
+Average:      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+Average:        0         1    0.00    1.00    0.00    0.00    1.00     -  systemd
+Average:      999      1234   12.00    3.00    0.00    0.50   15.00     -  mysqld
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 2), PID: 1, User: "0", System: 1, Total: 1, Command: "systemd"},
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 2), PID: 1234, User: "999", USR: 12, System: 3, Wait: 0.5, Total: 15, Command: "mysqld"},
+			},
+		},
+		{
+			name: "sysstat 11 en_US AM/PM without %wait",
+			output: `Linux 3.10.0-1160.el7.x86_64 (db01) 	11/25/2024 	_x86_64_	(4 CPU)
+
+09:59:59 AM   UID       PID    %usr %system  %guest    %CPU   CPU  Command
+10:00:00 AM    27      2345    5.00    1.00    0.00    6.00     0  mysqld
+12:00:00 PM    27      2345    7.00    2.00    0.00    9.00     2  mysqld
+01:00:00 PM    27      2345    1.00    1.00    0.00    2.00     2  mysqld
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 0), PID: 2345, User: "27", USR: 5, System: 1, Total: 6, Command: "mysqld"},
+				// 12 PM 是中午
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 12, 0, 0), PID: 2345, User: "27", USR: 7, System: 2, Total: 9, Command: "mysqld"},
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 13, 0, 0), PID: 2345, User: "27", USR: 1, System: 1, Total: 2, Command: "mysqld"},
+			},
+		},
+		{
+			name: "sysstat 9 %user without UID column, short year",
+			output: `Linux 2.6.32-754.el6.x86_64 (old01) 	11/25/24 	_x86_64_	(2 CPU)
+
+10:00:01 PM       PID    %user %system  %guest    %CPU   CPU  Command
+10:00:02 PM      1234    2.00    1.00    0.00    3.00     0  java
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 22, 0, 2), PID: 1234, USR: 2, System: 1, Total: 3, Command: "java"},
+			},
+		},
+		{
+			name: "de_DE date in banner",
+			output: `Linux 6.1.0-18-amd64 (app01) 	25.11.2024 	_x86_64_	(16 CPU)
+
+10:00:01      UID       PID  minflt/s  majflt/s     VSZ     RSS   %MEM  Command
+10:00:02     1000      4321     12.00      0.00 2097152  524288   3.20  java
+`,
+			want: []interface{}{
+				ProcessMemStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 2), PID: 4321, User: "1000", MinorFaults: 12, VSZ: 2097152, RSS: 524288, Command: "java"},
+			},
+		},
+		{
+			name: "en_GB date in banner",
+			output: `Linux 6.1.0-18-amd64 (app01) 	25/11/2024 	_x86_64_	(16 CPU)
+
+10:00:01      UID       PID   kB_rd/s   kB_wr/s kB_ccwr/s iodelay  Command
+10:00:02        0       812      0.00     16.00      4.00       2  jbd2/sda1-8
+`,
+			want: []interface{}{
+				ProcessIOStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 2), PID: 812, User: "0", WriteKBPS: 16, KBCCWR: 4, IODelay: 2, Command: "jbd2/sda1-8"},
+			},
+		},
+		{
+			name: "zh_CN 上午/下午",
+			output: `Linux 4.18.0-513.el8.x86_64 (cn01) 	2024-11-25 	_x86_64_	(8 CPU)
+
+10:00:01 上午   UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+10:00:02 上午     0       100    1.00    0.00    0.00    0.00    1.00     0  sshd
+02:00:02 下午     0       100    2.00    0.00    0.00    0.00    2.00     0  sshd
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 2), PID: 100, User: "0", USR: 1, Total: 1, Command: "sshd"},
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 14, 0, 2), PID: 100, User: "0", USR: 2, Total: 2, Command: "sshd"},
+			},
+		},
+		{
+			name: "sysstat 10 -d without kB_ccwr/s and iodelay",
+			output: `Linux 2.6.32-754.el6.x86_64 (old01) 	11/25/2024 	_x86_64_	(2 CPU)
+
+10:00:01 AM       PID   kB_rd/s   kB_wr/s  Command
+10:00:02 AM      2222      8.00      1.50  rsync
+`,
+			want: []interface{}{
+				ProcessIOStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 2), PID: 2222, ReadKBPS: 8, WriteKBPS: 1.5, Command: "rsync"},
+			},
+		},
+		{
+			name: "-u -r -d sections with -l command lines",
+			output: `Linux 5.15.0-91-generic (web01) 	2024-11-25 	_x86_64_	(8 CPU)
+
+10:00:01      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+10:00:02      999      1234   12.00    3.00    0.00    0.50   15.00     1  /usr/sbin/mysqld --defaults-file=/etc/my.cnf
+
+10:00:01      UID       PID  minflt/s  majflt/s     VSZ     RSS   %MEM  Command
+10:00:02      999      1234      1.00      2.00 1800000  900000  11.00  /usr/sbin/mysqld --defaults-file=/etc/my.cnf
+
+10:00:01      UID       PID   kB_rd/s   kB_wr/s kB_ccwr/s iodelay  Command
+10:00:02      999      1234    100.00    200.00      0.00       7  /usr/sbin/mysqld --defaults-file=/etc/my.cnf
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 2), PID: 1234, User: "999", USR: 12, System: 3, Wait: 0.5, Total: 15, Command: "/usr/sbin/mysqld --defaults-file=/etc/my.cnf"},
+				ProcessMemStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 2), PID: 1234, User: "999", MinorFaults: 1, MajorFaults: 2, VSZ: 1800000, RSS: 900000, Command: "/usr/sbin/mysqld --defaults-file=/etc/my.cnf"},
+				ProcessIOStats{IP: testIP, Timestamp: at(2024, 11, 25, 10, 0, 2), PID: 1234, User: "999", ReadKBPS: 100, WriteKBPS: 200, IODelay: 7, Command: "/usr/sbin/mysqld --defaults-file=/etc/my.cnf"},
+			},
+		},
+		{
+			name: "-h one line with cpu, memory and io",
+			output: `Linux 5.15.0-91-generic (web01) 	11/25/2024 	_x86_64_	(8 CPU)
+
+# Time        UID       PID    %usr %system  %guest   %wait    %CPU   CPU  minflt/s  majflt/s     VSZ     RSS   %MEM   kB_rd/s   kB_wr/s kB_ccwr/s iodelay  Command
+ 1732528802     0      1234    1.00    2.00    0.00    0.00    3.00     2      5.00      0.00  123456   65432   0.80      4.00      8.00      0.00       0  nginx
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: time.Unix(1732528802, 0), PID: 1234, User: "0", USR: 1, System: 2, Total: 3, Command: "nginx"},
+				ProcessMemStats{IP: testIP, Timestamp: time.Unix(1732528802, 0), PID: 1234, User: "0", MinorFaults: 5, VSZ: 123456, RSS: 65432, Command: "nginx"},
+				ProcessIOStats{IP: testIP, Timestamp: time.Unix(1732528802, 0), PID: 1234, User: "0", ReadKBPS: 4, WriteKBPS: 8, Command: "nginx"},
+			},
+		},
+		{
+			name: "-H epoch time",
+			output: `Linux 5.15.0-91-generic (web01) 	11/25/2024 	_x86_64_	(8 CPU)
+
+1732521601      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+1732521602        0       100    1.00    0.00    0.00    0.00    1.00     0  sshd
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: time.Unix(1732521602, 0), PID: 100, User: "0", USR: 1, Total: 1, Command: "sshd"},
+			},
+		},
+		{
+			name: "midnight rollover 24h",
+			output: `Linux 5.15.0-91-generic (web01) 	2024-12-31 	_x86_64_	(8 CPU)
+
+23:59:58      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+23:59:59        0       100    1.00    0.00    0.00    0.00    1.00     0  sshd
+
+00:00:00      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+00:00:01        0       100    2.00    0.00    0.00    0.00    2.00     0  sshd
+00:00:02        0       100    3.00    0.00    0.00    0.00    3.00     0  sshd
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 12, 31, 23, 59, 59), PID: 100, User: "0", USR: 1, Total: 1, Command: "sshd"},
+				ProcessCPUStats{IP: testIP, Timestamp: at(2025, 1, 1, 0, 0, 1), PID: 100, User: "0", USR: 2, Total: 2, Command: "sshd"},
+				ProcessCPUStats{IP: testIP, Timestamp: at(2025, 1, 1, 0, 0, 2), PID: 100, User: "0", USR: 3, Total: 3, Command: "sshd"},
+			},
+		},
+		{
+			name: "midnight rollover AM/PM",
+			output: `Linux 3.10.0-1160.el7.x86_64 (db01) 	02/28/2024 	_x86_64_	(4 CPU)
+
+11:59:58 PM   UID       PID    %usr %system  %guest    %CPU   CPU  Command
+11:59:59 PM    27      2345    5.00    1.00    0.00    6.00     0  mysqld
+12:00:01 AM    27      2345    4.00    1.00    0.00    5.00     0  mysqld
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 2, 28, 23, 59, 59), PID: 2345, User: "27", USR: 5, System: 1, Total: 6, Command: "mysqld"},
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 2, 29, 0, 0, 1), PID: 2345, User: "27", USR: 4, System: 1, Total: 5, Command: "mysqld"},
+			},
+		},
+		{
+			name: "new banner resets the date",
+			output: `Linux 5.15.0-91-generic (web01) 	2024-11-25 	_x86_64_	(8 CPU)
+
+23:00:00      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+23:00:01        0       100    1.00    0.00    0.00    0.00    1.00     0  sshd
+Linux 5.15.0-91-generic (web01) 	2024-11-27 	_x86_64_	(8 CPU)
+
+08:00:00      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+08:00:01        0       100    2.00    0.00    0.00    0.00    2.00     0  sshd
+`,
+			want: []interface{}{
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 25, 23, 0, 1), PID: 100, User: "0", USR: 1, Total: 1, Command: "sshd"},
+				ProcessCPUStats{IP: testIP, Timestamp: at(2024, 11, 27, 8, 0, 1), PID: 100, User: "0", USR: 2, Total: 2, Command: "sshd"},
+			},
+		},
+		{
+			name: "missing banner",
+			output: `10:00:01      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command
+10:00:02        0         1    0.00    1.00    0.00    0.00    1.00     3  systemd
+`,
+			bad: 1,
+		},
+		{
+			name: "data before header is skipped",
+			output: `Linux 5.15.0-91-generic (web01) 	2024-11-25 	_x86_64_	(8 CPU)
+10:00:02        0         1    0.00    1.00    0.00    0.00    1.00     3  systemd
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, bad := parseOutput(t, tt.output)
+			if bad != tt.bad {
+				t.Errorf("got %d bad lines, want %d", bad, tt.bad)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Errorf("row %d\n got %+v\nwant %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParsePidstatHeader(t *testing.T) {
+	tests := []struct {
+		line             string
+		cpu, memory, io  bool
+		header           bool
+		pidIdx, uidIdx   int
+		commandIdx, cols int
+	}{
+		{line: "10:00:01      UID       PID    %usr %system  %guest   %wait    %CPU   CPU  Command",
+			header: true, cpu: true, pidIdx: 1, uidIdx: 0, commandIdx: 8, cols: 9},
+		{line: "10:00:01 AM   UID       PID  minflt/s  majflt/s     VSZ     RSS   %MEM  Command",
+			header: true, memory: true, pidIdx: 1, uidIdx: 0, commandIdx: 7, cols: 8},
+		{line: "10:00:01 PM       PID    %user %system  %guest    %CPU   CPU  Command",
+			header: true, cpu: true, pidIdx: 0, uidIdx: -1, commandIdx: 6, cols: 7},
+		{line: "# Time        UID       PID    %usr %system  %guest   %wait    %CPU   CPU  minflt/s  majflt/s     VSZ     RSS   %MEM   kB_rd/s   kB_wr/s kB_ccwr/s iodelay  Command",
+			header: true, cpu: true, memory: true, io: true, pidIdx: 1, uidIdx: 0, commandIdx: 17, cols: 18},
+		{line: "1732521601      UID      TGID       TID    %usr %system  %guest   %wait    %CPU   CPU  Command",
+			header: true, cpu: true, pidIdx: 1, uidIdx: 0, commandIdx: 9, cols: 10},
+		{line: "10:00:01     USER       PID   kB_rd/s   kB_wr/s kB_ccwr/s iodelay  Command",
+			header: true, io: true, pidIdx: 1, uidIdx: 0, commandIdx: 6, cols: 7},
+		{line: "10:00:02        0         1    0.00    1.00    0.00    0.00    1.00     3  systemd"},
+		{line: "Linux 5.15.0-91-generic (web01) 	2024-11-25 	_x86_64_	(8 CPU)"},
+	}
+	for _, tt := range tests {
+		h := parsePidstatHeader(tt.line)
+		if (h != nil) != tt.header {
+			t.Errorf("%q: header = %v, want %v", tt.line, h != nil, tt.header)
+			continue
+		}
+		if h == nil {
+			continue
+		}
+		if h.cpu != tt.cpu || h.memory != tt.memory || h.io != tt.io {
+			t.Errorf("%q: cpu/memory/io = %v/%v/%v, want %v/%v/%v", tt.line, h.cpu, h.memory, h.io, tt.cpu, tt.memory, tt.io)
+		}
+		uid, ok := h.columns["UID"]
+		if !ok {
+			uid = -1
+		}
+		if h.columns["PID"] != tt.pidIdx || uid != tt.uidIdx || h.columns["Command"] != tt.commandIdx || len(h.columns) != tt.cols {
+			t.Errorf("%q: PID/UID/Command/columns = %d/%d/%d/%d, want %d/%d/%d/%d", tt.line,
+				h.columns["PID"], uid, h.columns["Command"], len(h.columns), tt.pidIdx, tt.uidIdx, tt.commandIdx, tt.cols)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package target
+
+import (
+	"bufio"
+	"fmt"
+	"moniter/matcher"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// BackendPidstat 通过 pidstat 子进程采集
+	BackendPidstat = "pidstat"
+	// BackendProc 直接读取 /proc 采集
+	BackendProc = "proc"
+)
+
+// procRoot proc 文件系统挂载点
+const procRoot = "/proc"
+
+// procInfo 进程基本信息
+type procInfo struct {
+	pid  int
+	comm string
+	user string
+}
+
+// userCache uid -> 用户名 缓存
+var userCache sync.Map
+
+// listProcs 列出 /proc 下命中匹配规则的进程
+func listProcs(m *matcher.Matcher) ([]procInfo, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", procRoot, err)
+	}
+
+	procs := make([]procInfo, 0)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := readComm(pid)
+		if err != nil {
+			// 进程在扫描期间退出
+			continue
+		}
+		status, err := readProcStatus(pid)
+		if err != nil {
+			continue
+		}
+		info := procInfo{
+			pid:  pid,
+			comm: comm,
+			user: lookupUser(status["Uid"]),
+		}
+		if !m.Match(matcher.Process{PID: pid, Comm: comm, User: info.user}) {
+			continue
+		}
+		procs = append(procs, info)
+	}
+	return procs, nil
+}
+
+// readComm 读取 /proc/[pid]/comm
+func readComm(pid int) (string, error) {
+	b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// readProcStatus 读取 /proc/[pid]/status，返回 key -> value
+func readProcStatus(pid int) (map[string]string, error) {
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	status := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		status[key] = strings.TrimSpace(value)
+	}
+	return status, scanner.Err()
+}
+
+// readProcStat 读取 /proc/[pid]/stat，返回进程名之后的字段（下标 0 对应 state）
+func readProcStat(pid int) ([]string, error) {
+	b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil, err
+	}
+	// comm 中可能包含空格和括号，以最后一个 ')' 为界
+	idx := strings.LastIndexByte(string(b), ')')
+	if idx < 0 {
+		return nil, fmt.Errorf("invalid stat format for pid %d", pid)
+	}
+	return strings.Fields(string(b[idx+1:])), nil
+}
+
+// lookupUser 将 Uid 行（real effective saved fs）转换为用户名
+func lookupUser(uidLine string) string {
+	fields := strings.Fields(uidLine)
+	if len(fields) == 0 {
+		return ""
+	}
+	uid := fields[0]
+	if name, ok := userCache.Load(uid); ok {
+		return name.(string)
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	userCache.Store(uid, name)
+	return name
+}